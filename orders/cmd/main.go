@@ -4,14 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"gozon/orders/internal/broker"
+	"gozon/orders/internal/auth"
 	"gozon/orders/internal/service"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gozon/orders/internal/handler"
 	"gozon/orders/internal/storage"
+	"gozon/platform/admin"
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+	"gozon/platform/events"
+	"gozon/platform/outbox"
+	"gozon/platform/retention"
 
 	_ "github.com/lib/pq"
 
@@ -29,6 +38,14 @@ import (
 // @host      localhost:8000
 // @BasePath  /
 
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+
+// @securityDefinitions.apikey  AdminToken
+// @in                          header
+// @name                        X-Admin-Token
+
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
@@ -50,17 +67,70 @@ func main() {
 	if kafkaBrokers == "" {
 		kafkaBrokers = "localhost:9092"
 	}
-	producer := broker.NewProducer(kafkaBrokers, "orders.created")
+	producer := broker.NewProducer(kafkaBrokers)
 	defer producer.Close()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	wsHub := handler.NewWSHub()
+	notificationRepo := storage.NewNotificationRepository(db)
+	// EVENT_FORMATS выбирает формат данных по топику, например "orders.created=protobuf"; по умолчанию JSON
+	formats, err := events.FormatsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	repo := storage.NewOrderRepository(db, formats)
+	wsCfg := handler.DefaultWSHubConfig()
+	if v, err := strconv.Atoi(os.Getenv("WS_MAX_CONNS_PER_USER")); err == nil {
+		wsCfg.MaxConnsPerUser = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("WS_SEND_BUFFER")); err == nil {
+		wsCfg.SendBufferSize = v
+	}
+	if v := os.Getenv("WS_ALLOWED_ORIGINS"); v != "" {
+		wsCfg.AllowedOrigins = strings.Split(v, ",")
+	}
+	if err := wsCfg.Validate(); err != nil {
+		log.Fatalf("Invalid WebSocket config: %v", err)
+	}
+	jwtSecret := os.Getenv("WS_JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("WS_JWT_SECRET is required")
+	}
+	verifier := auth.NewVerifier(jwtSecret)
+	notificationBus := storage.NewNotificationBus(db, dbConnStr)
+	wsHub := handler.NewWSHub(notificationRepo, repo, notificationBus, verifier, wsCfg)
+	go wsHub.StartFanout(ctx)
+	go wsHub.StartDeliveryMarker(ctx)
 	http.HandleFunc("/ws", wsHub.HandleConnection)
-	go service.StartRelay(ctx, db, producer)
-	processor := service.NewOrderProcessor(kafkaBrokers, db, wsHub)
+	http.HandleFunc("/api/orders/events", wsHub.HandleEvents)
+	// OUTBOX_RELAY_MODE=cdc читает outbox из логической репликации (нужен wal_level=logical)
+	if err := outbox.StartFromEnv(ctx, db, dbConnStr, producer, storage.OutboxTopics); err != nil {
+		log.Fatal(err)
+	}
+	retentionCfg, err := retention.ConfigFromEnv(false) // у сервиса заказов нет inbox
+	if err != nil {
+		log.Fatal(err)
+	}
+	go retention.NewCleaner(db, retentionCfg).Start(ctx)
+	webhookRepo := storage.NewWebhookRepository(db)
+	workers, err := consumer.WorkersFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	paymentsRetry, err := consumer.RetryConfigFromEnv(service.TopicPaymentsProcessed, "PAYMENTS_PROCESSED_DLQ_TOPIC")
+	if err != nil {
+		log.Fatal(err)
+	}
+	balanceRetry, err := consumer.RetryConfigFromEnv(service.TopicBalanceChanged, "BALANCE_CHANGED_DLQ_TOPIC")
+	if err != nil {
+		log.Fatal(err)
+	}
+	processor := service.NewOrderProcessor(kafkaBrokers, db, producer, paymentsRetry, workers, wsHub, webhookRepo)
 	go processor.Start(ctx)
+	balanceProcessor := service.NewBalanceProcessor(kafkaBrokers, producer, balanceRetry, workers, wsHub)
+	go balanceProcessor.Start(ctx)
+	dispatcher := service.NewWebhookDispatcher(webhookRepo, service.DefaultWebhookDispatcherConfig())
+	go dispatcher.Start(ctx)
 
-	repo := storage.NewOrderRepository(db)
 	h := handler.NewHandler(repo)
 	http.HandleFunc("/api/orders", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
@@ -72,6 +142,46 @@ func main() {
 		}
 	})
 
+	// Вебхуки принадлежат пользователю из токена и получают только события его заказов
+	wh := handler.NewWebhookHandler(webhookRepo)
+	http.HandleFunc("/api/webhooks", verifier.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			wh.CreateWebhook(w, r)
+		case http.MethodGet:
+			wh.GetWebhooks(w, r)
+		case http.MethodDelete:
+			wh.DeleteWebhook(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/api/webhooks/dead-letters", verifier.Middleware(wh.GetDeadDeliveries))
+	http.HandleFunc("/api/webhooks/dead-letters/replay", verifier.Middleware(wh.ReplayDeadDeliveries))
+
+	// Служебные маршруты: только на порту сервиса (gateway их не проксирует) и с ADMIN_TOKEN
+	adminToken := admin.TokenFromEnv()
+	admin.Register(adminToken, db, kafkaBrokers, producer, paymentsRetry.DeadLetter.Topic, balanceRetry.DeadLetter.Topic)
+	http.HandleFunc("/internal/ws/stats", admin.RequireToken(adminToken, wsHub.HandleStats))
+
+	nh := handler.NewNotificationHandler(notificationRepo)
+	http.HandleFunc("/api/notifications", verifier.Middleware(nh.GetNotifications))
+	http.HandleFunc("/api/notifications/read", verifier.Middleware(nh.MarkRead))
+
+	// Dev-выдача токенов слушает отдельный loopback-адрес и не видна через основной порт и gateway
+	if addr := os.Getenv("AUTH_DEV_ISSUER_ADDR"); addr != "" {
+		if !auth.IsLoopbackAddr(addr) {
+			log.Fatalf("AUTH_DEV_ISSUER_ADDR must be a loopback address, got %q", addr)
+		}
+		ah := handler.NewAuthHandler(verifier, time.Hour)
+		issuerMux := http.NewServeMux()
+		issuerMux.HandleFunc("/api/auth/token", ah.IssueToken)
+		go func() {
+			log.Fatal(http.ListenAndServe(addr, issuerMux))
+		}()
+		log.Printf("WARNING: development token issuer enabled at http://%s/api/auth/token", addr)
+	}
+
 	http.HandleFunc("/swagger/", httpSwagger.WrapHandler)
 	port := os.Getenv("HTTP_PORT")
 	if port == "" {
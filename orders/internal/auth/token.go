@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SubprotocolBearer — подпротокол WebSocket для передачи токена из браузера,
+// где нельзя выставить заголовок Authorization:
+//
+//	new WebSocket(url, ["bearer", token])
+const SubprotocolBearer = "bearer"
+
+var ErrNoToken = errors.New("token is required")
+
+type Claims struct {
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+// Verifier проверяет и выпускает HS256 токены. user_id берется из claim "sub".
+type Verifier struct {
+	key []byte
+}
+
+func NewVerifier(key string) *Verifier {
+	return &Verifier{key: []byte(key)}
+}
+
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return v.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sub claim: %w", err)
+	}
+	return &Claims{UserID: userID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// Issue выпускает токен для пользователя со сроком жизни ttl
+func (v *Verifier) Issue(userID uuid.UUID, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID.String(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	signed, err := token.SignedString(v.key)
+	return signed, expiresAt, err
+}
+
+// TokenFromRequest достает токен из "Authorization: Bearer <token>"
+// или из Sec-WebSocket-Protocol вида "bearer, <token>"
+func TokenFromRequest(r *http.Request) (string, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok || token == "" {
+			return "", errors.New("malformed Authorization header")
+		}
+		return token, nil
+	}
+	var protocols []string
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			protocols = append(protocols, strings.TrimSpace(p))
+		}
+	}
+	for i, p := range protocols {
+		if p == SubprotocolBearer && i+1 < len(protocols) {
+			return protocols[i+1], nil
+		}
+	}
+	return "", ErrNoToken
+}
+
+// TokenFromRequestOrQuery — TokenFromRequest с запасным ?access_token=. Только для SSE:
+// EventSource в браузере не умеет выставлять заголовки, а токен в URL попадает в логи прокси.
+func TokenFromRequestOrQuery(r *http.Request) (string, error) {
+	token, err := TokenFromRequest(r)
+	if errors.Is(err, ErrNoToken) {
+		if token = r.URL.Query().Get("access_token"); token != "" {
+			return token, nil
+		}
+	}
+	return token, err
+}
+
+type claimsKey struct{}
+
+// Middleware пропускает запрос только с действительным токеном и кладет его claims в контекст
+func (v *Verifier) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := TokenFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	}
+}
+
+// ClaimsFromContext возвращает claims, сохраненные Middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// IsLoopbackAddr сообщает, что адрес host:port слушает только локальный интерфейс
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
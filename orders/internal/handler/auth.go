@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gozon/orders/internal/auth"
+
+	"github.com/google/uuid"
+)
+
+type TokenRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AuthHandler выпускает токены для WebSocket без проверки личности.
+// Предназначен только для локальной разработки и обслуживается отдельным loopback-адресом
+// (AUTH_DEV_ISSUER_ADDR): в проде токены выпускает внешний auth-сервис.
+type AuthHandler struct {
+	verifier *auth.Verifier
+	ttl      time.Duration
+}
+
+func NewAuthHandler(verifier *auth.Verifier, ttl time.Duration) *AuthHandler {
+	return &AuthHandler{verifier: verifier, ttl: ttl}
+}
+
+// IssueToken godoc
+// @Summary      Токен для WebSocket (dev)
+// @Description  Выпускает подписанный токен для user_id. Доступен только на loopback-адресе AUTH_DEV_ISSUER_ADDR, не через основной порт
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body TokenRequest true "User ID"
+// @Success      200  {object}  TokenResponse
+// @Failure      400  {string}  string "Неверные данные"
+// @Router       /api/auth/token [post]
+func (h *AuthHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		http.Error(w, "Invalid user_id", http.StatusBadRequest)
+		return
+	}
+	token, expiresAt, err := h.verifier.Issue(req.UserID, h.ttl)
+	if err != nil {
+		http.Error(w, "Token error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, ExpiresAt: expiresAt})
+}
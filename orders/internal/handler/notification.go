@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gozon/orders/internal/auth"
+	"gozon/orders/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type MarkReadRequest struct {
+	// Пустой список означает "прочитать все"
+	NotificationIDs []uuid.UUID `json:"notification_ids"`
+}
+
+type NotificationHandler struct {
+	repo *storage.NotificationRepository
+}
+
+func NewNotificationHandler(repo *storage.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{repo: repo}
+}
+
+// GetNotifications godoc
+// @Summary      Уведомления пользователя
+// @Description  Возвращает последние 100 уведомлений, включая пропущенные, пока пользователь был офлайн.
+// @Description  Пользователь берется из токена (Authorization: Bearer).
+// @Tags         notifications
+// @Produce      json
+// @Security     BearerAuth
+// @Param        unread query bool false "Только непрочитанные"
+// @Success      200  {array}  storage.Notification
+// @Failure      401  {string}  string "Нет или неверный токен"
+// @Router       /api/notifications [get]
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := h.repo.GetNotificationsByUserID(r.Context(), claims.UserID, unreadOnly, 100)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if notifications == nil {
+		notifications = []*storage.Notification{}
+	}
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// MarkRead godoc
+// @Summary      Отметить уведомления прочитанными
+// @Description  Пользователь берется из токена (Authorization: Bearer).
+// @Tags         notifications
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body MarkReadRequest true "ID уведомлений"
+// @Success      200  {object}  map[string]int64
+// @Failure      400  {string}  string "Неверные данные"
+// @Failure      401  {string}  string "Нет или неверный токен"
+// @Router       /api/notifications/read [post]
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req MarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
+		return
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	n, err := h.repo.MarkRead(r.Context(), claims.UserID, req.NotificationIDs)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"updated": n})
+}
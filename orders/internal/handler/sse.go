@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gozon/orders/internal/auth"
+)
+
+// HandleEvents godoc
+// @Summary      Поток уведомлений (Server-Sent Events)
+// @Description  Альтернатива WebSocket для сетей, где прокси ломают Upgrade. Отдает те же события, что и /ws.
+// @Description  id события равен seq: браузер сам присылает Last-Event-ID при переподключении.
+// @Description  Токен передается в Authorization: Bearer или в ?access_token=.
+// @Tags         orders
+// @Produce      text/event-stream
+// @Param        access_token query string false "Токен (если нельзя передать заголовок)"
+// @Param        channels query string false "Каналы через запятую: orders, balance, order:{id}"
+// @Param        Last-Event-ID header string false "Последний полученный seq"
+// @Success      200  {string}  string "event stream"
+// @Failure      401  {string}  string "Нет или неверный токен"
+// @Router       /api/orders/events [get]
+func (h *WSHub) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("since")
+	}
+	params, status, err := h.parseSubscribeRequest(r, auth.TokenFromRequestOrQuery, cursor)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx не должен буферизовать поток
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("SSE is not supported by response writer: %v", err)
+		return
+	}
+
+	client := newSubscriber(params.claims.UserID.String(), TransportSSE, h.cfg.SendBufferSize, h.markDelivered)
+	// Закрыть HTTP ответ из другой горутины нельзя: сигналом служит done, а писатель ниже просто выходит
+	detach := h.attach(r.Context(), client, params)
+	defer detach()
+
+	// Просим браузер переподключаться через 3 секунды
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	heartbeat := time.NewTicker(h.cfg.SSEHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.done:
+			return
+		case msg := <-client.send:
+			rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteWait))
+			if msg.seq != 0 {
+				fmt.Fprintf(w, "id: %d\n", msg.seq)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", msg.data)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			client.sent(msg)
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteWait))
+			fmt.Fprint(w, ": heartbeat\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// hubMessage — кадр в очереди отправки соединения
+type hubMessage struct {
+	data []byte
+	// seq — номер события в потоке пользователя, 0 для служебных кадров
+	seq int64
+	// notificationID заполнен для уведомлений из inbox, после записи они отмечаются доставленными
+	notificationID uuid.UUID
+}
+
+// subscriber — одно соединение пользователя независимо от транспорта (WebSocket или SSE).
+// Хаб кладет сообщения в send, а транспорт в единственной горутине пишет их клиенту.
+type subscriber struct {
+	userID      string
+	transport   string
+	send        chan hubMessage
+	done        chan struct{}
+	closeOnce   sync.Once
+	connectedAt time.Time
+	dropped     atomic.Int64
+	// redelivered — повторные отправки неподтвержденных уведомлений, с dropped не смешиваются
+	redelivered atomic.Int64
+
+	// Пока идет replay пропущенных событий, live-сообщения откладываются в held,
+	// чтобы клиент получил поток строго по возрастанию seq.
+	replayMu  sync.Mutex
+	replaying bool
+	held      []hubMessage
+
+	subMu sync.RWMutex
+	subs  map[string]struct{}
+
+	// requireAck: уведомление считается доставленным только после ack клиента.
+	// SSE не имеет обратного канала, там доставкой считается запись в поток.
+	requireAck bool
+	ackMu      sync.Mutex
+	unacked    map[uuid.UUID]*unackedMessage
+
+	// onSent вызывается, когда уведомление доставлено (записано или подтверждено клиентом)
+	onSent func(id uuid.UUID)
+	// onClose закрывает нижележащее соединение
+	onClose func(code int, reason string)
+}
+
+// unackedMessage — отправленное, но не подтвержденное клиентом уведомление
+type unackedMessage struct {
+	msg      hubMessage
+	sentAt   time.Time
+	attempts int
+}
+
+// Транспорты подписчика
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+func newSubscriber(userID, transport string, bufferSize int, onSent func(uuid.UUID)) *subscriber {
+	return &subscriber{
+		userID:      userID,
+		transport:   transport,
+		requireAck:  transport == TransportWebSocket,
+		unacked:     make(map[uuid.UUID]*unackedMessage),
+		send:        make(chan hubMessage, bufferSize),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		replaying:   true,
+		subs:        make(map[string]struct{}),
+		onSent:      onSent,
+	}
+}
+
+// enqueue кладет сообщение в очередь без блокировки.
+// false означает, что буфер переполнен и клиент не успевает читать.
+func (c *subscriber) enqueue(msg hubMessage) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if c.replaying {
+		if len(c.held) >= cap(c.send) {
+			c.dropped.Add(1)
+			return false
+		}
+		c.held = append(c.held, msg)
+		return true
+	}
+	return c.trySend(msg)
+}
+
+func (c *subscriber) trySend(msg hubMessage) bool {
+	if c.offer(msg) {
+		return true
+	}
+	c.dropped.Add(1)
+	return false
+}
+
+// offer кладет сообщение в очередь, если есть место, ничего не считая
+func (c *subscriber) offer(msg hubMessage) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// finishReplay переключает клиента в live-режим. Отложенные сообщения, уже
+// попавшие в replay (seq <= lastSeq), отбрасываются как дубликаты.
+func (c *subscriber) finishReplay(lastSeq int64) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	c.replaying = false
+	held := c.held
+	c.held = nil
+	for _, msg := range held {
+		if msg.seq != 0 && msg.seq <= lastSeq {
+			continue
+		}
+		if !c.trySend(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueueWait ждет свободного места в очереди. Используется при replay,
+// где сообщений может быть больше размера буфера.
+func (c *subscriber) enqueueWait(ctx context.Context, msg hubMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close закрывает соединение с кодом и причиной. Безопасно вызывать несколько раз.
+func (c *subscriber) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.onClose != nil {
+			c.onClose(code, reason)
+		}
+	})
+}
+
+// sent вызывается транспортом при отправке сообщения клиенту
+func (c *subscriber) sent(msg hubMessage) {
+	if msg.notificationID == uuid.Nil {
+		return
+	}
+	if !c.requireAck {
+		c.delivered(msg.notificationID)
+		return
+	}
+	c.ackMu.Lock()
+	u, ok := c.unacked[msg.notificationID]
+	if !ok {
+		u = &unackedMessage{msg: msg}
+		c.unacked[msg.notificationID] = u
+	}
+	u.sentAt = time.Now()
+	u.attempts++
+	c.ackMu.Unlock()
+}
+
+// ack подтверждает получение уведомления клиентом
+func (c *subscriber) ack(id uuid.UUID) {
+	c.ackMu.Lock()
+	_, ok := c.unacked[id]
+	delete(c.unacked, id)
+	c.ackMu.Unlock()
+	if ok {
+		c.delivered(id)
+	}
+}
+
+// redeliver повторно ставит в очередь уведомления без ack дольше timeout.
+// После maxAttempts попыток уведомление снимается с соединения: в БД оно остается
+// недоставленным и придет при следующем подключении. Возвращает число снятых.
+func (c *subscriber) redeliver(timeout time.Duration, maxAttempts int) int {
+	c.ackMu.Lock()
+	defer c.ackMu.Unlock()
+	givenUp := 0
+	for id, u := range c.unacked {
+		if time.Since(u.sentAt) < timeout {
+			continue
+		}
+		if u.attempts >= maxAttempts {
+			delete(c.unacked, id)
+			givenUp++
+			continue
+		}
+		// Сдвигаем sentAt, чтобы не ставить сообщение повторно, пока оно ждет в очереди.
+		// Полная очередь — не потеря: сообщение останется в unacked до следующего тика.
+		if c.offer(u.msg) {
+			u.sentAt = time.Now()
+			c.redelivered.Add(1)
+		}
+	}
+	return givenUp
+}
+
+func (c *subscriber) delivered(id uuid.UUID) {
+	if c.onSent != nil {
+		c.onSent(id)
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"gozon/orders/internal/auth"
+	"gozon/orders/internal/netguard"
+	"gozon/orders/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Если не передан, секрет будет сгенерирован и возвращен один раз
+	Secret string `json:"secret"`
+}
+
+type ReplayDeliveriesRequest struct {
+	// Пустой список означает повтор всех dead-доставок
+	DeliveryIDs []uuid.UUID `json:"delivery_ids"`
+}
+
+type WebhookHandler struct {
+	repo *storage.WebhookRepository
+}
+
+func NewWebhookHandler(repo *storage.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{repo: repo}
+}
+
+// CreateWebhook godoc
+// @Summary      Регистрация вебхука
+// @Description  Подписывает endpoint на события заказов владельца токена. Запросы подписываются HMAC-SHA256
+// @Description  (заголовок X-Gozon-Signature). Адреса внутренней сети (loopback, частные, link-local) запрещены.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body CreateWebhookRequest true "Endpoint и типы событий"
+// @Success      201  {object}  storage.Webhook
+// @Failure      400  {string}  string "Неверные данные"
+// @Failure      401  {string}  string "Нет или неверный токен"
+// @Failure      500  {string}  string "Внутренняя ошибка"
+// @Router       /api/webhooks [post]
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
+		return
+	}
+	if err := netguard.CheckURL(r.Context(), req.URL); err != nil {
+		http.Error(w, "Некорректный url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		http.Error(w, "Нужно указать хотя бы один тип события", http.StatusBadRequest)
+		return
+	}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(storage.WebhookEventTypes, t) {
+			http.Error(w, "Неизвестный тип события: "+t, http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		rand.Read(buf)
+		req.Secret = hex.EncodeToString(buf)
+	}
+
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	wh := &storage.Webhook{
+		ID:         uuid.New(),
+		OwnerID:    claims.UserID,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		Active:     true,
+	}
+	if err := h.repo.CreateWebhook(r.Context(), wh); err != nil {
+		http.Error(w, "Ошибка регистрации вебхука: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wh)
+}
+
+// GetWebhooks godoc
+// @Summary      Список вебхуков
+// @Description  Возвращает endpoint'ы владельца токена (без секретов)
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  storage.Webhook
+// @Router       /api/webhooks [get]
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	hooks, err := h.repo.ListWebhooks(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if hooks == nil {
+		hooks = []*storage.Webhook{}
+	}
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// DeleteWebhook godoc
+// @Summary      Удаление вебхука
+// @Description  Удаляет endpoint и все его недоставленные события
+// @Tags         webhooks
+// @Security     BearerAuth
+// @Param        id query string true "Webhook UUID"
+// @Success      204
+// @Failure      404  {string}  string "Не найден"
+// @Router       /api/webhooks [delete]
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	err = h.repo.DeleteWebhook(r.Context(), id, claims.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeadDeliveries godoc
+// @Summary      Dead-letter доставки
+// @Description  Возвращает доставки вебхуков владельца токена, исчерпавшие все попытки
+// @Tags         webhooks
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  storage.WebhookDelivery
+// @Router       /api/webhooks/dead-letters [get]
+func (h *WebhookHandler) GetDeadDeliveries(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	deliveries, err := h.repo.ListDeadDeliveries(r.Context(), claims.UserID, 100)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if deliveries == nil {
+		deliveries = []*storage.WebhookDelivery{}
+	}
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ReplayDeadDeliveries godoc
+// @Summary      Повтор dead-letter доставок
+// @Description  Возвращает dead-доставки вебхуков владельца токена в очередь со сброшенным счетчиком попыток
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body ReplayDeliveriesRequest false "ID доставок"
+// @Success      200  {object}  map[string]int64
+// @Router       /api/webhooks/dead-letters/replay [post]
+func (h *WebhookHandler) ReplayDeadDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req ReplayDeliveriesRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	n, err := h.repo.RequeueDeadDeliveries(r.Context(), claims.UserID, req.DeliveryIDs)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"requeued": n})
+}
@@ -1,38 +1,254 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"gozon/orders/internal/auth"
+	"gozon/orders/internal/storage"
+
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-// WSHub хранит активные соединения: UserID -> Conn
+// closeTokenExpired — код закрытия сокета по истечении токена (диапазон 4000-4999 отдан приложениям)
+const closeTokenExpired = 4001
+
+// replayPageSize — сколько событий replay читает из базы за один запрос
+const replayPageSize = 500
+
+// Очередь отметок о доставке и размер одного UPDATE
+const (
+	deliveredQueueSize = 4096
+	deliveredBatchSize = 500
+)
+
+type WSHubConfig struct {
+	// MaxConnsPerUser ограничивает число одновременных соединений (вкладки, устройства).
+	// При превышении закрывается самое старое соединение.
+	MaxConnsPerUser int
+	// SendBufferSize — размер очереди отправки одного соединения.
+	// Клиент, не успевающий ее разбирать, отключается.
+	SendBufferSize int
+	WriteWait      time.Duration // deadline на запись одного кадра
+	PongWait       time.Duration // сколько ждем pong, прежде чем считать соединение мертвым
+	PingPeriod     time.Duration // должен быть меньше PongWait
+	MaxMessageSize int64
+	// AllowedOrigins — разрешенные значения заголовка Origin. "*" разрешает любой,
+	// пустой список — только same-origin.
+	AllowedOrigins []string
+	// AckTimeout — через сколько неподтвержденное уведомление отправляется повторно
+	AckTimeout          time.Duration
+	MaxDeliveryAttempts int
+	// SSEHeartbeat — период комментариев-heartbeat в SSE потоке, чтобы прокси не рвали простаивающее соединение
+	SSEHeartbeat time.Duration
+}
+
+func DefaultWSHubConfig() WSHubConfig {
+	return WSHubConfig{
+		MaxConnsPerUser:     5,
+		SendBufferSize:      64,
+		WriteWait:           10 * time.Second,
+		PongWait:            60 * time.Second,
+		PingPeriod:          54 * time.Second,
+		MaxMessageSize:      4096,
+		AckTimeout:          10 * time.Second,
+		MaxDeliveryAttempts: 5,
+		SSEHeartbeat:        15 * time.Second,
+	}
+}
+
+// Validate проверяет, что таймауты и размеры положительные, а ping уходит раньше, чем истечет PongWait
+func (c WSHubConfig) Validate() error {
+	switch {
+	case c.MaxConnsPerUser <= 0:
+		return errors.New("MaxConnsPerUser must be positive")
+	case c.SendBufferSize <= 0:
+		return errors.New("SendBufferSize must be positive")
+	case c.WriteWait <= 0 || c.PongWait <= 0 || c.PingPeriod <= 0:
+		return errors.New("WriteWait, PongWait and PingPeriod must be positive")
+	case c.PingPeriod >= c.PongWait:
+		return errors.New("PingPeriod must be less than PongWait")
+	case c.MaxMessageSize <= 0:
+		return errors.New("MaxMessageSize must be positive")
+	case c.AckTimeout <= 0:
+		return errors.New("AckTimeout must be positive")
+	case c.MaxDeliveryAttempts <= 0:
+		return errors.New("MaxDeliveryAttempts must be positive")
+	case c.SSEHeartbeat <= 0:
+		return errors.New("SSEHeartbeat must be positive")
+	}
+	return nil
+}
+
+// WSStats — состояние хаба для мониторинга
+type WSStats struct {
+	Users       int                 `json:"users"`
+	Connections int                 `json:"connections"`
+	QueueDepth  int                 `json:"queue_depth"`
+	Dropped     int64               `json:"dropped"`
+	Evicted     int64               `json:"evicted"`
+	Clients     []WSConnectionStats `json:"clients"`
+}
+
+type WSConnectionStats struct {
+	UserID      string    `json:"user_id"`
+	Transport   string    `json:"transport"`
+	QueueDepth  int       `json:"queue_depth"`
+	Dropped     int64     `json:"dropped"`
+	Redelivered int64     `json:"redelivered"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// WSHub хранит активные соединения: UserID -> набор подписчиков (WebSocket и SSE)
 type WSHub struct {
-	clients  map[string]*websocket.Conn
-	mu       sync.RWMutex
-	upgrader websocket.Upgrader
+	clients       map[string]map[*subscriber]struct{}
+	mu            sync.RWMutex
+	upgrader      websocket.Upgrader
+	notifications *storage.NotificationRepository
+	orders        *storage.OrderRepository
+	bus           *storage.NotificationBus
+	verifier      *auth.Verifier
+	instanceID    string
+	cfg           WSHubConfig
+
+	// delivered — ID доставленных уведомлений; пишутся в БД пачками вне горутин записи в сокет
+	delivered chan uuid.UUID
+
+	dropped atomic.Int64 // сообщения, не поместившиеся в очередь
+	evicted atomic.Int64 // соединения, отключенные как медленные
+}
+
+func NewWSHub(notifications *storage.NotificationRepository, orders *storage.OrderRepository,
+	bus *storage.NotificationBus, verifier *auth.Verifier, cfg WSHubConfig) *WSHub {
+	h := &WSHub{
+		clients:       make(map[string]map[*subscriber]struct{}),
+		notifications: notifications,
+		orders:        orders,
+		bus:           bus,
+		verifier:      verifier,
+		instanceID:    uuid.NewString(),
+		cfg:           cfg,
+		delivered:     make(chan uuid.UUID, deliveredQueueSize),
+	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin:  h.checkOrigin,
+		Subprotocols: []string{auth.SubprotocolBearer},
+	}
+	return h
 }
 
-func NewWSHub() *WSHub {
-	return &WSHub{
-		clients: make(map[string]*websocket.Conn),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
-		},
+func (h *WSHub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Не браузер: Origin выставляют только браузеры
+		return true
+	}
+	if len(h.cfg.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartFanout слушает уведомления, созданные другими инстансами, и доставляет их
+// локальным соединениям. Блокируется до отмены ctx.
+func (h *WSHub) StartFanout(ctx context.Context) {
+	err := h.bus.Listen(ctx, func(signal storage.NotificationSignal) {
+		if signal.Origin == h.instanceID {
+			return
+		}
+		if len(h.connections(signal.UserID.String())) == 0 {
+			return
+		}
+		n, err := h.notifications.GetNotification(ctx, signal.NotificationID)
+		if err != nil {
+			log.Printf("Failed to load notification %s from bus: %v", signal.NotificationID, err)
+			return
+		}
+		h.deliverLocal(n)
+	})
+	if err != nil {
+		log.Printf("Notification bus stopped: %v", err)
+	}
+}
+
+// subscribeParams — общие параметры подключения для WebSocket и SSE
+type subscribeParams struct {
+	claims *auth.Claims
+	// since — последний seq, который клиент успел получить. -1: досылаем только недоставленное.
+	since    int64
+	channels []string
+}
+
+// parseSubscribeRequest проверяет токен и разбирает курсор и каналы.
+// tokenFrom и cursor специфичны для транспорта: откуда брать токен и курсор (?since= или Last-Event-ID).
+func (h *WSHub) parseSubscribeRequest(r *http.Request, tokenFrom func(*http.Request) (string, error), cursor string) (*subscribeParams, int, error) {
+	token, err := tokenFrom(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	claims, err := h.verifier.Verify(token)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	// Пользователь определяется по подписанному токену, а не по query-параметру
+	if v := r.URL.Query().Get("user_id"); v != "" && !strings.EqualFold(v, claims.UserID.String()) {
+		return nil, http.StatusForbidden, errors.New("user_id does not match token")
+	}
+	params := &subscribeParams{claims: claims, since: -1}
+	if cursor != "" {
+		if params.since, err = strconv.ParseInt(cursor, 10, 64); err != nil || params.since < 0 {
+			return nil, http.StatusBadRequest, errors.New("cursor must be a non-negative integer")
+		}
+	}
+	var ok bool
+	if params.channels, ok = parseChannels(r.URL.Query().Get("channels")); !ok {
+		return nil, http.StatusBadRequest, errors.New("unknown channel")
+	}
+	return params, 0, nil
+}
+
+// attach регистрирует подписчика в хабе, запускает replay и следит за сроком токена.
+// Возвращает функцию, которую транспорт вызывает при отключении клиента.
+func (h *WSHub) attach(ctx context.Context, client *subscriber, params *subscribeParams) (detach func()) {
+	client.subscribe(params.channels...)
+	h.register(client)
+
+	// Токен живет ограниченное время: по истечении закрываем соединение, клиент переподключится с новым
+	expiry := time.AfterFunc(time.Until(params.claims.ExpiresAt), func() {
+		log.Printf("Token expired for user %s (%s)", client.userID, client.transport)
+		client.close(closeTokenExpired, "token expired")
+	})
+
+	// Досылаем то, что пришло, пока пользователь был офлайн, затем переходим в live
+	go h.replay(ctx, params.claims.UserID, params.since, client)
+
+	return func() {
+		expiry.Stop()
+		h.unregister(client)
 	}
 }
 
 // HandleConnection обрабатывает входящие WS соединения
 func (h *WSHub) HandleConnection(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	userID = strings.ToLower(userID)
-	if userID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+	params, status, err := h.parseSubscribeRequest(r, auth.TokenFromRequest, r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
 		return
 	}
 	conn, err := h.upgrader.Upgrade(w, r, nil)
@@ -40,34 +256,249 @@ func (h *WSHub) HandleConnection(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to upgrade WS: %v", err)
 		return
 	}
+	client := newSubscriber(params.claims.UserID.String(), TransportWebSocket, h.cfg.SendBufferSize, h.markDelivered)
+	attachWebSocket(client, conn)
+	detach := h.attach(r.Context(), client, params)
+	defer detach()
+	go wsWritePump(client, conn, h.cfg)
+
+	// Держим соединение открытым пока клиент не отключится
+	wsReadPump(conn, h.cfg, func(data []byte) {
+		h.handleCommand(r.Context(), client, data)
+	})
+}
+
+// register добавляет соединение пользователя, вытесняя самое старое при превышении лимита
+func (h *WSHub) register(client *subscriber) {
+	h.mu.Lock()
+	conns, ok := h.clients[client.userID]
+	if !ok {
+		conns = make(map[*subscriber]struct{})
+		h.clients[client.userID] = conns
+	}
+	var evicted *subscriber
+	if h.cfg.MaxConnsPerUser > 0 && len(conns) >= h.cfg.MaxConnsPerUser {
+		for c := range conns {
+			if evicted == nil || c.connectedAt.Before(evicted.connectedAt) {
+				evicted = c
+			}
+		}
+		delete(conns, evicted)
+	}
+	conns[client] = struct{}{}
+	total := len(conns)
+	h.mu.Unlock()
+
+	if evicted != nil {
+		log.Printf("Connection limit reached for user %s, closing the oldest one", client.userID)
+		evicted.close(websocket.ClosePolicyViolation, "too many connections")
+	}
+	log.Printf("User connected to WS: %s (%d connections)", client.userID, total)
+}
 
+// unregister удаляет только свое соединение, не трогая другие вкладки пользователя
+func (h *WSHub) unregister(client *subscriber) {
 	h.mu.Lock()
-	h.clients[userID] = conn
+	if conns, ok := h.clients[client.userID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(h.clients, client.userID)
+		}
+	}
 	h.mu.Unlock()
-	log.Printf("User connected to WS: %s", userID)
+	client.close(websocket.CloseNormalClosure, "")
+}
 
-	// Держим соединение открытым пока клиент не отключится
+// SendNotification сохраняет уведомление в inbox пользователя и ставит его в очередь
+// каждого соединения пользователя на всех инстансах. Вызов не блокируется на медленных клиентах.
+// Если пользователь офлайн, уведомление будет дослано при следующем подключении.
+func (h *WSHub) SendNotification(ctx context.Context, userID string, notifType string, data map[string]string) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		log.Printf("Invalid notification recipient %q: %v", userID, err)
+		return
+	}
+	payload, _ := json.Marshal(data)
+	n := &storage.Notification{
+		ID:      uuid.New(),
+		UserID:  uid,
+		Type:    notifType,
+		Payload: payload,
+	}
+	if err := h.notifications.SaveNotification(ctx, n); err != nil {
+		log.Printf("Failed to save notification for user %s: %v", userID, err)
+	} else {
+		// Пользователь может быть подключен к другой реплике
+		signal := storage.NotificationSignal{Origin: h.instanceID, UserID: uid, NotificationID: n.ID}
+		if err := h.bus.Publish(ctx, signal); err != nil {
+			log.Printf("Failed to publish notification %s to bus: %v", n.ID, err)
+		}
+	}
+	h.deliverLocal(n)
+}
+
+// deliverLocal ставит уведомление в очередь каждого соединения пользователя на этом инстансе
+func (h *WSHub) deliverLocal(n *storage.Notification) {
+	userID := n.UserID.String()
+	msg := hubMessage{data: notificationEnvelope(n), seq: n.Seq, notificationID: n.ID}
+	channels := notificationChannels(n)
+	queued := 0
+	for _, c := range h.connections(userID) {
+		if !c.subscribedTo(channels) {
+			continue
+		}
+		if c.enqueue(msg) {
+			queued++
+			continue
+		}
+		// Очередь переполнена: клиент не успевает читать, отключаем его.
+		// Уведомление останется недоставленным и придет после переподключения.
+		h.dropped.Add(1)
+		h.evicted.Add(1)
+		log.Printf("Slow WS consumer evicted for user %s", userID)
+		c.close(websocket.CloseTryAgainLater, "slow consumer")
+	}
+	if queued > 0 {
+		log.Printf("Push notification queued for user %s (%d connections)", userID, queued)
+	}
+}
+
+// Stats возвращает глубину очередей и счетчики отброшенных сообщений
+func (h *WSHub) Stats() WSStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	stats := WSStats{
+		Users:   len(h.clients),
+		Dropped: h.dropped.Load(),
+		Evicted: h.evicted.Load(),
+		Clients: []WSConnectionStats{},
+	}
+	for userID, conns := range h.clients {
+		for c := range conns {
+			depth := len(c.send)
+			stats.Connections++
+			stats.QueueDepth += depth
+			stats.Clients = append(stats.Clients, WSConnectionStats{
+				UserID:      userID,
+				Transport:   c.transport,
+				QueueDepth:  depth,
+				Dropped:     c.dropped.Load(),
+				Redelivered: c.redelivered.Load(),
+				ConnectedAt: c.connectedAt,
+			})
+		}
+	}
+	return stats
+}
+
+// HandleStats godoc
+// @Summary      Состояние WebSocket хаба
+// @Description  Число соединений, глубина очередей отправки и счетчики отброшенных сообщений.
+// @Description  Служебный маршрут: содержит user_id всех подключенных, поэтому требует токен администратора.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Success      200  {object}  WSStats
+// @Failure      401  {string}  string "Нет или неверный токен администратора"
+// @Router       /internal/ws/stats [get]
+func (h *WSHub) HandleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Stats())
+}
+
+func (h *WSHub) connections(userID string) []*subscriber {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	conns := make([]*subscriber, 0, len(h.clients[userID]))
+	for c := range h.clients[userID] {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// replay отправляет события из durable-хранилища постранично, пока клиент не догонит поток:
+// с номером больше since либо, если курсор не передан, все недоставленные. Live-события на это
+// время откладываются. Если базу прочитать не удалось, соединение закрывается, чтобы клиент
+// переподключился со своим курсором, а не пропустил события молча.
+func (h *WSHub) replay(ctx context.Context, userID uuid.UUID, since int64, client *subscriber) {
+	load := h.notifications.GetSince
+	if since < 0 {
+		load = h.notifications.GetUndelivered
+	}
+	lastSeq := since
+	replayed := 0
+	var err error
 	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
-			h.mu.Lock()
-			delete(h.clients, userID)
-			h.mu.Unlock()
+		var page []*storage.Notification
+		if page, err = load(ctx, userID, lastSeq, replayPageSize); err != nil {
 			break
 		}
+		for _, n := range page {
+			lastSeq = n.Seq
+			if !client.subscribedTo(notificationChannels(n)) {
+				continue
+			}
+			if !client.enqueueWait(ctx, hubMessage{data: notificationEnvelope(n), seq: n.Seq, notificationID: n.ID}) {
+				return
+			}
+			replayed++
+		}
+		if len(page) < replayPageSize {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to load missed notifications for user %s: %v", userID, err)
+		client.close(websocket.CloseInternalServerErr, "replay failed")
+		return
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %d notifications to user %s (up to seq %d)", replayed, userID, lastSeq)
+	}
+	if !client.finishReplay(lastSeq) {
+		h.dropped.Add(1)
+		h.evicted.Add(1)
+		log.Printf("Slow WS consumer evicted for user %s", userID)
+		client.close(websocket.CloseTryAgainLater, "slow consumer")
 	}
 }
 
-// SendNotification отправляет JSON сообщение юзеру
-func (h *WSHub) SendNotification(userID string, message interface{}) {
-	h.mu.RLock()
-	conn, ok := h.clients[userID]
-	h.mu.RUnlock()
-	if ok {
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("WS send error: %v", err)
-			conn.Close()
-		} else {
-			log.Printf("Push notification sent to user %s", userID)
+// markDelivered вызывается из горутины записи в сокет, поэтому не ходит в БД, а только ставит ID
+// в очередь StartDeliveryMarker. Если очередь переполнена, уведомление остается недоставленным
+// и придет повторно при следующем подключении (клиент отбрасывает повторы по seq).
+func (h *WSHub) markDelivered(id uuid.UUID) {
+	select {
+	case h.delivered <- id:
+	default:
+		log.Printf("Delivery marker queue is full, notification %s stays undelivered", id)
+	}
+}
+
+// StartDeliveryMarker отмечает доставленные уведомления в БД пачками. Блокируется до отмены ctx.
+func (h *WSHub) StartDeliveryMarker(ctx context.Context) {
+	for {
+		var ids []uuid.UUID
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-h.delivered:
+			ids = append(ids, id)
+		}
+		// Забираем все, что накопилось, одним UPDATE
+	collect:
+		for len(ids) < deliveredBatchSize {
+			select {
+			case id := <-h.delivered:
+				ids = append(ids, id)
+			default:
+				break collect
+			}
+		}
+		// ctx может быть уже отменен, а доставленное нужно успеть отметить
+		markCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := h.notifications.MarkDelivered(markCtx, ids...); err != nil {
+			log.Printf("Failed to mark %d notifications delivered: %v", len(ids), err)
 		}
+		cancel()
 	}
 }
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// attachWebSocket привязывает подписчика к WebSocket соединению
+func attachWebSocket(c *subscriber, conn *websocket.Conn) {
+	c.onClose = func(code int, reason string) {
+		// WriteControl можно вызывать конкурентно с WriteMessage
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
+// wsReadPump держит соединение, продлевает read deadline при каждом pong и
+// передает команды клиента в handle. Возвращается, когда клиент отключился или перестал отвечать на ping.
+func wsReadPump(conn *websocket.Conn, cfg WSHubConfig, handle func([]byte)) {
+	conn.SetReadLimit(cfg.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cfg.PongWait))
+	})
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType == websocket.TextMessage {
+			handle(data)
+		}
+	}
+}
+
+// wsWritePump — единственный писатель в conn (gorilla/websocket не допускает
+// конкурентную запись): отправляет очередь, ping'и и повторяет неподтвержденные уведомления
+func wsWritePump(c *subscriber, conn *websocket.Conn, cfg WSHubConfig) {
+	ticker := time.NewTicker(cfg.PingPeriod)
+	defer ticker.Stop()
+	ackTicker := time.NewTicker(cfg.AckTimeout / 2)
+	defer ackTicker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			// Ожидание ack регистрируем до записи: клиент может ответить раньше, чем вернется WriteMessage
+			c.sent(msg)
+			conn.SetWriteDeadline(time.Now().Add(cfg.WriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg.data); err != nil {
+				c.close(websocket.CloseInternalServerErr, "write failed")
+				return
+			}
+		case <-ackTicker.C:
+			if n := c.redeliver(cfg.AckTimeout, cfg.MaxDeliveryAttempts); n > 0 {
+				log.Printf("%d notifications were not acked by user %s, left for replay", n, c.userID)
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteWait)); err != nil {
+				c.close(websocket.CloseInternalServerErr, "ping failed")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gozon/orders/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// ProtocolVersion — версия конверта сообщений. Меняется только при несовместимых изменениях.
+const ProtocolVersion = 1
+
+// Envelope — единый формат сообщений в обе стороны (WebSocket и SSE).
+// Уведомления несут seq и требуют ack, ответы на команды — correlation_id запроса.
+type Envelope struct {
+	Version       int             `json:"v"`
+	Type          string          `json:"type"`
+	ID            string          `json:"id"`
+	Seq           int64           `json:"seq,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+	Timestamp     time.Time       `json:"ts"`
+}
+
+// Служебные типы сообщений сервера
+const (
+	MessageSubscriptions = "SUBSCRIPTIONS"
+	MessagePong          = "PONG"
+	MessageOrder         = "ORDER"
+	MessageError         = "ERROR"
+)
+
+// Команды клиента
+const (
+	CommandSubscribe   = "subscribe"
+	CommandUnsubscribe = "unsubscribe"
+	CommandAck         = "ack"
+	CommandPing        = "ping"
+	CommandGetOrder    = "get_order"
+)
+
+type channelsPayload struct {
+	Channels []string `json:"channels"`
+}
+
+type ackPayload struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+type getOrderPayload struct {
+	OrderID uuid.UUID `json:"order_id"`
+}
+
+type errorPayload struct {
+	Error string `json:"error"`
+}
+
+// newEnvelope собирает серверное сообщение
+func newEnvelope(msgType, correlationID string, payload interface{}) []byte {
+	raw, _ := json.Marshal(payload)
+	data, _ := json.Marshal(Envelope{
+		Version:       ProtocolVersion,
+		Type:          msgType,
+		ID:            uuid.NewString(),
+		CorrelationID: correlationID,
+		Payload:       raw,
+		Timestamp:     time.Now().UTC(),
+	})
+	return data
+}
+
+// notificationEnvelope — уведомление из inbox в формате конверта. id совпадает с ID уведомления,
+// его клиент и присылает в ack.
+func notificationEnvelope(n *storage.Notification) []byte {
+	data, _ := json.Marshal(Envelope{
+		Version:   ProtocolVersion,
+		Type:      n.Type,
+		ID:        n.ID.String(),
+		Seq:       n.Seq,
+		Payload:   n.Payload,
+		Timestamp: n.CreatedAt.UTC(),
+	})
+	return data
+}
+
+// handleCommand разбирает сообщение клиента и отвечает с тем же correlation_id
+func (h *WSHub) handleCommand(ctx context.Context, c *subscriber, data []byte) {
+	var req Envelope
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.reply(MessageError, "", errorPayload{Error: "bad json"})
+		return
+	}
+	if req.Version != ProtocolVersion {
+		c.reply(MessageError, req.ID, errorPayload{Error: "unsupported protocol version"})
+		return
+	}
+
+	switch req.Type {
+	case CommandSubscribe, CommandUnsubscribe:
+		var p channelsPayload
+		json.Unmarshal(req.Payload, &p)
+		channels := make([]string, 0, len(p.Channels))
+		for _, ch := range p.Channels {
+			ch = strings.ToLower(strings.TrimSpace(ch))
+			if !validChannel(ch) {
+				c.reply(MessageError, req.ID, errorPayload{Error: "unknown channel: " + ch})
+				return
+			}
+			channels = append(channels, ch)
+		}
+		if req.Type == CommandUnsubscribe {
+			c.unsubscribe(channels...)
+		} else if !c.subscribe(channels...) {
+			c.reply(MessageError, req.ID, errorPayload{Error: "too many subscriptions"})
+			return
+		}
+		c.reply(MessageSubscriptions, req.ID, channelsPayload{Channels: c.subscriptions()})
+
+	case CommandAck:
+		var p ackPayload
+		json.Unmarshal(req.Payload, &p)
+		for _, id := range p.IDs {
+			c.ack(id)
+		}
+
+	case CommandPing:
+		c.reply(MessagePong, req.ID, struct{}{})
+
+	case CommandGetOrder:
+		var p getOrderPayload
+		if err := json.Unmarshal(req.Payload, &p); err != nil || p.OrderID == uuid.Nil {
+			c.reply(MessageError, req.ID, errorPayload{Error: "order_id is required"})
+			return
+		}
+		order, err := h.orders.GetOrderByID(ctx, p.OrderID)
+		// Чужой заказ неотличим от несуществующего
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && order.UserID.String() != c.userID) {
+			c.reply(MessageError, req.ID, errorPayload{Error: "order not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load order %s for WS command: %v", p.OrderID, err)
+			c.reply(MessageError, req.ID, errorPayload{Error: "internal error"})
+			return
+		}
+		c.reply(MessageOrder, req.ID, order)
+
+	default:
+		c.reply(MessageError, req.ID, errorPayload{Error: "unknown command: " + req.Type})
+	}
+}
+
+// reply ставит служебный ответ в очередь соединения
+func (c *subscriber) reply(msgType, correlationID string, payload interface{}) {
+	if !c.enqueue(hubMessage{data: newEnvelope(msgType, correlationID, payload)}) {
+		log.Printf("Failed to queue reply for user %s", c.userID)
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gozon/orders/internal/storage"
+)
+
+// Типы уведомлений, которые отправляет хаб
+const (
+	NotificationOrderUpdated   = "ORDER_UPDATED"
+	NotificationBalanceChanged = "BALANCE_CHANGED"
+)
+
+// Каналы подписки. Кроме них есть канал конкретного заказа "order:{id}".
+const (
+	ChannelOrders  = "orders"
+	ChannelBalance = "balance"
+
+	channelOrderPrefix = "order:"
+)
+
+// defaultChannels — подписка нового соединения, если клиент не передал ?channels=
+var defaultChannels = []string{ChannelOrders}
+
+// maxSubscriptions ограничивает число каналов у одного соединения
+const maxSubscriptions = 100
+
+// notificationChannels возвращает каналы, в которые попадает уведомление
+func notificationChannels(n *storage.Notification) []string {
+	switch n.Type {
+	case NotificationOrderUpdated:
+		var payload struct {
+			OrderID string `json:"order_id"`
+		}
+		json.Unmarshal(n.Payload, &payload)
+		return []string{ChannelOrders, channelOrderPrefix + strings.ToLower(payload.OrderID)}
+	case NotificationBalanceChanged:
+		return []string{ChannelBalance}
+	default:
+		return nil
+	}
+}
+
+// validChannel проверяет имя канала из запроса клиента
+func validChannel(ch string) bool {
+	if ch == ChannelOrders || ch == ChannelBalance {
+		return true
+	}
+	id, ok := strings.CutPrefix(ch, channelOrderPrefix)
+	return ok && len(id) == 36
+}
+
+// parseChannels разбирает список каналов из query-параметра
+func parseChannels(v string) ([]string, bool) {
+	if v == "" {
+		return defaultChannels, true
+	}
+	var channels []string
+	for _, ch := range strings.Split(v, ",") {
+		ch = strings.ToLower(strings.TrimSpace(ch))
+		if !validChannel(ch) {
+			return nil, false
+		}
+		channels = append(channels, ch)
+	}
+	return channels, true
+}
+
+func (c *subscriber) subscribe(channels ...string) bool {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, ch := range channels {
+		if _, ok := c.subs[ch]; !ok && len(c.subs) >= maxSubscriptions {
+			return false
+		}
+		c.subs[ch] = struct{}{}
+	}
+	return true
+}
+
+func (c *subscriber) unsubscribe(channels ...string) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, ch := range channels {
+		delete(c.subs, ch)
+	}
+}
+
+func (c *subscriber) subscriptions() []string {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	res := make([]string, 0, len(c.subs))
+	for ch := range c.subs {
+		res = append(res, ch)
+	}
+	return res
+}
+
+// subscribedTo сообщает, подписан ли клиент хотя бы на один из каналов
+func (c *subscriber) subscribedTo(channels []string) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	for _, ch := range channels {
+		if _, ok := c.subs[ch]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Package netguard не дает сервису ходить по адресам внутренней сети (SSRF) по URL,
+// которые задают пользователи, например endpoint'ам вебхуков.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("address is not publicly routable")
+
+// sharedAddressSpace — 100.64.0.0/10 (CGNAT), IsPrivate его не покрывает
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Allowed сообщает, что адрес публичный: не loopback, не частная сеть, не link-local и не multicast
+func Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsUnspecified() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// CheckURL проверяет, что URL — http(s) и все адреса его хоста публичные
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http(s) url")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !Allowed(addr) {
+			return fmt.Errorf("%s resolves to %s: %w", u.Hostname(), addr, ErrForbiddenAddress)
+		}
+	}
+	return nil
+}
+
+// Dialer проверяет адрес уже после DNS-резолва, перед самим соединением, поэтому
+// хост, который после регистрации стал указывать во внутреннюю сеть, и редиректы туда тоже отсекаются
+func Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !Allowed(addrPort.Addr()) {
+				return fmt.Errorf("dial %s: %w", address, ErrForbiddenAddress)
+			}
+			return nil
+		},
+	}
+}
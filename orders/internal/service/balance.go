@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"gozon/orders/internal/handler"
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+	"gozon/platform/contracts"
+	"gozon/platform/events"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// eventTypeBalanceChanged — тип события payments с новым балансом пользователя
+const eventTypeBalanceChanged = "gozon.balance.changed"
+
+// BalanceProcessor пересылает изменения баланса из payments подписчикам канала "balance"
+type BalanceProcessor struct {
+	consumer *consumer.Group
+	hub      *handler.WSHub
+}
+
+func NewBalanceProcessor(brokers string, producer *broker.Producer, retry consumer.RetryConfig, workers int, hub *handler.WSHub) *BalanceProcessor {
+	p := &BalanceProcessor{hub: hub}
+	p.consumer = consumer.NewWithRetries(consumer.Config{
+		Name:    "Balance Consumer",
+		Brokers: brokers,
+		Topic:   TopicBalanceChanged,
+		GroupID: "orders-balance-group",
+		// Ключ payments.balance_changed — пользователь: значения баланса не обгоняют друг друга
+		Workers: workers,
+	}, producer, retry, consumer.Dispatch(map[string]consumer.Handler{
+		eventTypeBalanceChanged: p.handle,
+		"":                      p.handle,
+	}), consumer.Recover())
+	return p
+}
+
+func (p *BalanceProcessor) Start(ctx context.Context) {
+	p.consumer.Start(ctx)
+}
+
+func (p *BalanceProcessor) handle(ctx context.Context, m kafka.Message) error {
+	var event contracts.BalanceChangedEvent
+	if err := schemas.Decode(eventTypeBalanceChanged, events.FromKafka(m), &event); err != nil {
+		return err
+	}
+	data := map[string]string{
+		"user_id": event.UserID.String(),
+		"balance": strconv.FormatInt(event.Balance, 10),
+		"delta":   strconv.FormatInt(event.Delta, 10),
+		"reason":  event.Reason,
+	}
+	if event.OrderID != nil {
+		data["order_id"] = event.OrderID.String()
+	}
+	p.hub.SendNotification(ctx, event.UserID.String(), handler.NotificationBalanceChanged, data)
+	return nil
+}
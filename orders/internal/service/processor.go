@@ -4,65 +4,103 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"gozon/orders/internal/handler"
+	"gozon/orders/internal/storage"
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+	"gozon/platform/contracts"
+	"gozon/platform/events"
 
-	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
 
-type PaymentStatusEvent struct {
-	OrderID uuid.UUID `json:"order_id"`
-	Status  string    `json:"status"`
-}
+// eventTypePaymentProcessed — тип события payments с итогом оплаты заказа
+const eventTypePaymentProcessed = "gozon.payment.processed"
 
 type OrderProcessor struct {
-	db     *sql.DB
-	reader *kafka.Reader
-	hub    *handler.WSHub
+	db       *sql.DB
+	consumer *consumer.Group
+	hub      *handler.WSHub
+	webhooks *storage.WebhookRepository
 }
 
-func NewOrderProcessor(brokers string, db *sql.DB, hub *handler.WSHub) *OrderProcessor {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{brokers},
-		Topic:    "payments.processed",
-		GroupID:  "orders-group",
-		MinBytes: 1,
-		MaxBytes: 10e6,
-		MaxWait:  10 * time.Millisecond,
-	})
-	return &OrderProcessor{db: db, reader: reader, hub: hub}
+// NewOrderProcessor собирает консьюмер payments.processed. Сообщение, не обработанное за
+// всех уровней повтора retry, уходит в dead-letter топик.
+func NewOrderProcessor(brokers string, db *sql.DB, producer *broker.Producer, retry consumer.RetryConfig, workers int,
+	hub *handler.WSHub, webhooks *storage.WebhookRepository) *OrderProcessor {
+	p := &OrderProcessor{db: db, hub: hub, webhooks: webhooks}
+	p.consumer = consumer.NewWithRetries(consumer.Config{
+		Name:    "Order Response Consumer",
+		Brokers: brokers,
+		Topic:   TopicPaymentsProcessed,
+		GroupID: "orders-group",
+		// Ключ payments.processed — заказ: статусы одного заказа применяются по порядку
+		Workers: workers,
+	}, producer, retry, consumer.Dispatch(map[string]consumer.Handler{
+		eventTypePaymentProcessed: p.handle,
+		"":                        p.handle,
+	}), consumer.Recover())
+	return p
 }
 
 func (p *OrderProcessor) Start(ctx context.Context) {
-	log.Println("Order Response Consumer started...")
-	for {
-		m, err := p.reader.FetchMessage(ctx)
-		if err != nil {
-			log.Printf("Consumer error: %v", err)
-			continue
-		}
+	p.consumer.Start(ctx)
+}
+
+func (p *OrderProcessor) handle(ctx context.Context, m kafka.Message) error {
+	incoming := events.FromKafka(m)
+	var event contracts.PaymentStatusEvent
+	if err := schemas.Decode(eventTypePaymentProcessed, incoming, &event); err != nil {
+		return err
+	}
+	userID, err := p.updateStatus(ctx, incoming.ID, event)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Повтор не поможет: заказа нет в этой базе
+		return consumer.Permanent(fmt.Errorf("order %s not found", event.OrderID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order %s: %w", event.OrderID, err)
+	}
+	log.Printf("Order %s updated to status: %s", event.OrderID, event.Status)
+	p.hub.SendNotification(ctx, userID, handler.NotificationOrderUpdated, map[string]string{
+		"order_id": event.OrderID.String(),
+		"status":   event.Status,
+	})
+	return nil
+}
+
+// updateStatus меняет статус заказа и ставит вебхуки в очередь в одной транзакции.
+// eventID — ID события payments.processed, по нему отсеиваются повторные доставки вебхуков.
+// Возвращает владельца заказа.
+func (p *OrderProcessor) updateStatus(ctx context.Context, eventID string, event contracts.PaymentStatusEvent) (string, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
 
-		var event PaymentStatusEvent
-		if err := json.Unmarshal(m.Value, &event); err != nil {
-			continue
-		}
-		_, err = p.db.ExecContext(ctx, "UPDATE orders SET status = $1 WHERE id = $2", event.Status, event.OrderID)
-		if err == nil {
-			log.Printf("Order %s updated to status: %s", event.OrderID, event.Status)
-			// Узнаем чей это заказ
-			var userID string
-			err := p.db.QueryRowContext(ctx, "SELECT user_id FROM orders WHERE id = $1", event.OrderID).Scan(&userID)
-			if err == nil {
-				p.hub.SendNotification(userID, map[string]string{
-					"type":     "ORDER_UPDATED",
-					"order_id": event.OrderID.String(),
-					"status":   event.Status,
-				})
-			}
-		}
-		p.reader.CommitMessages(ctx, m)
+	var userID string
+	err = tx.QueryRowContext(ctx,
+		"UPDATE orders SET status = $1 WHERE id = $2 RETURNING user_id", event.Status, event.OrderID,
+	).Scan(&userID)
+	if err != nil {
+		return "", err
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event":       storage.EventOrderStatusChanged,
+		"order_id":    event.OrderID,
+		"user_id":     userID,
+		"status":      event.Status,
+		"occurred_at": time.Now().UTC(),
+	})
+	if err := p.webhooks.EnqueueDeliveries(ctx, tx, userID, eventID, storage.EventOrderStatusChanged, payload); err != nil {
+		return "", fmt.Errorf("webhook enqueue error: %w", err)
 	}
+	return userID, tx.Commit()
 }
@@ -0,0 +1,15 @@
+package service
+
+import "gozon/platform/events"
+
+// schemas — текущие версии событий, которые читает сервис заказов. При изменении схемы
+// версия поднимается, а для старой регистрируется upcaster.
+var schemas = events.NewRegistry().
+	Register(eventTypePaymentProcessed, 1, nil).
+	Register(eventTypeBalanceChanged, 1, nil)
+
+// Топики payments, которые читает сервис заказов
+const (
+	TopicPaymentsProcessed = "payments.processed"
+	TopicBalanceChanged    = "payments.balance_changed"
+)
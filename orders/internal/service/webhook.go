@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gozon/orders/internal/netguard"
+	"gozon/orders/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Заголовки, которые получает endpoint партнера
+const (
+	HeaderWebhookEvent     = "X-Gozon-Event"
+	HeaderWebhookDelivery  = "X-Gozon-Delivery"
+	HeaderWebhookTimestamp = "X-Gozon-Timestamp"
+	HeaderWebhookSignature = "X-Gozon-Signature"
+)
+
+type WebhookDispatcherConfig struct {
+	MaxAttempts  int           // после стольких неудач доставка уходит в dead-letter
+	BaseBackoff  time.Duration // задержка после первой неудачи, дальше удваивается
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration // таймаут одного HTTP запроса
+}
+
+func DefaultWebhookDispatcherConfig() WebhookDispatcherConfig {
+	return WebhookDispatcherConfig{
+		MaxAttempts:  8,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Second,
+		BatchSize:    20,
+		Timeout:      10 * time.Second,
+	}
+}
+
+// WebhookDispatcher доставляет события из персистентной очереди webhook_deliveries
+type WebhookDispatcher struct {
+	repo       *storage.WebhookRepository
+	client     *http.Client
+	cfg        WebhookDispatcherConfig
+	instanceID string
+}
+
+func NewWebhookDispatcher(repo *storage.WebhookRepository, cfg WebhookDispatcherConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repo: repo,
+		// Адрес проверяется при каждом соединении: DNS хоста мог смениться после регистрации
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{DialContext: netguard.Dialer(cfg.Timeout).DialContext},
+		},
+		cfg:        cfg,
+		instanceID: uuid.NewString(),
+	}
+}
+
+// Start запускает бесконечный цикл доставки
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	log.Println("Webhook Dispatcher started...")
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping Webhook Dispatcher...")
+			return
+		case <-ticker.C:
+			d.processBatch(ctx)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) processBatch(ctx context.Context) {
+	// Пачка доставляется последовательно, поэтому lease покрывает таймауты всех запросов пачки
+	// с запасом на один, чтобы последнюю доставку не взял второй инстанс
+	lease := time.Duration(d.cfg.BatchSize+1) * d.cfg.Timeout
+	deliveries, err := d.repo.ClaimDueDeliveries(ctx, d.cfg.BatchSize, lease, d.instanceID)
+	if err != nil {
+		log.Printf("Error claiming webhook deliveries: %v", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		if err := d.deliver(ctx, delivery); err != nil {
+			d.fail(ctx, delivery, err)
+			continue
+		}
+		if err := d.repo.MarkDelivered(ctx, delivery.ID, d.instanceID); err != nil {
+			log.Printf("Failed to mark webhook delivery %s: %v", delivery.ID, err)
+		} else {
+			log.Printf("Webhook delivery %s sent to %s", delivery.ID, delivery.URL)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *storage.WebhookDelivery) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookDelivery, delivery.ID.String())
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) fail(ctx context.Context, delivery *storage.WebhookDelivery, cause error) {
+	attempt := delivery.Attempts + 1
+	dead := attempt >= d.cfg.MaxAttempts
+	next := time.Now().Add(d.backoff(attempt))
+	if err := d.repo.MarkFailed(ctx, delivery.ID, d.instanceID, cause.Error(), next, dead); err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", delivery.ID, err)
+		return
+	}
+	if dead {
+		log.Printf("Webhook delivery %s moved to dead-letter after %d attempts: %v", delivery.ID, attempt, cause)
+	} else {
+		log.Printf("Webhook delivery %s failed (attempt %d): %v", delivery.ID, attempt, cause)
+	}
+}
+
+// backoff возвращает экспоненциальную задержку перед следующей попыткой
+func (d *WebhookDispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+// SignWebhook считает HMAC-SHA256 от "timestamp.payload".
+// Получатель проверяет подпись тем же секретом и отбрасывает старые timestamp'ы.
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
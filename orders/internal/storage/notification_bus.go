@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// notificationChannel — канал Postgres LISTEN/NOTIFY для рассылки уведомлений между инстансами
+const notificationChannel = "ws_notifications"
+
+// NotificationSignal — сообщение шины. Само уведомление лежит в таблице notifications,
+// по сети передаются только ссылки на него (payload NOTIFY ограничен 8000 байт).
+type NotificationSignal struct {
+	Origin         string    `json:"origin"`
+	UserID         uuid.UUID `json:"user_id"`
+	NotificationID uuid.UUID `json:"notification_id"`
+}
+
+// NotificationBus рассылает сигналы о новых уведомлениях всем инстансам orders,
+// чтобы push дошел до пользователя независимо от того, к какой реплике он подключен.
+type NotificationBus struct {
+	db      *sql.DB
+	connStr string
+}
+
+func NewNotificationBus(db *sql.DB, connStr string) *NotificationBus {
+	return &NotificationBus{db: db, connStr: connStr}
+}
+
+func (b *NotificationBus) Publish(ctx context.Context, signal NotificationSignal) error {
+	payload, _ := json.Marshal(signal)
+	_, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", notificationChannel, string(payload))
+	return err
+}
+
+// Listen блокируется до отмены ctx и вызывает handle на каждый полученный сигнал.
+// Соединение LISTEN переподключается автоматически.
+func (b *NotificationBus) Listen(ctx context.Context, handle func(NotificationSignal)) error {
+	listener := pq.NewListener(b.connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Notification bus listener error: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(notificationChannel); err != nil {
+		return err
+	}
+	log.Printf("Notification bus listening on channel %s", notificationChannel)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil приходит после переподключения: сигналы за время разрыва потеряны,
+			// клиенты догонят их через replay по seq
+			if n == nil {
+				log.Println("Notification bus reconnected")
+				continue
+			}
+			var signal NotificationSignal
+			if err := json.Unmarshal([]byte(n.Extra), &signal); err != nil {
+				log.Printf("Bad notification bus payload: %v", err)
+				continue
+			}
+			handle(signal)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Notification struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload" swaggertype:"object"`
+	Delivered bool            `json:"delivered"`
+	Read      bool            `json:"read"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// SaveNotification сохраняет уведомление до попытки отправки в сокет и присваивает ему
+// следующий номер в потоке пользователя. Номера монотонно растут и служат курсором для replay.
+func (r *NotificationRepository) SaveNotification(ctx context.Context, n *Notification) error {
+	return r.db.QueryRowContext(ctx, `
+		WITH next AS (
+			INSERT INTO notification_sequences (user_id, last_seq) VALUES ($2, 1)
+			ON CONFLICT (user_id) DO UPDATE SET last_seq = notification_sequences.last_seq + 1
+			RETURNING last_seq
+		)
+		INSERT INTO notifications (id, user_id, seq, type, payload)
+		SELECT $1, $2, last_seq, $3, $4 FROM next
+		RETURNING seq, created_at`,
+		n.ID, n.UserID, n.Type, []byte(n.Payload),
+	).Scan(&n.Seq, &n.CreatedAt)
+}
+
+// MarkDelivered отмечает уведомления, успешно отправленные в сокет
+func (r *NotificationRepository) MarkDelivered(ctx context.Context, ids ...uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE notifications SET delivered = true WHERE id = ANY($1::uuid[])", pq.Array(uuidStrings(ids)))
+	return err
+}
+
+func (r *NotificationRepository) GetNotification(ctx context.Context, id uuid.UUID) (*Notification, error) {
+	notifications, err := r.query(ctx, `
+		SELECT id, user_id, seq, type, payload, delivered, read, created_at
+		FROM notifications
+		WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return nil, ErrNotFound
+	}
+	return notifications[0], nil
+}
+
+// GetUndelivered возвращает не больше limit уведомлений, которые пользователь еще не получил,
+// с номером больше after, по возрастанию номера
+func (r *NotificationRepository) GetUndelivered(ctx context.Context, userID uuid.UUID, after int64, limit int) ([]*Notification, error) {
+	return r.query(ctx, `
+		SELECT id, user_id, seq, type, payload, delivered, read, created_at
+		FROM notifications
+		WHERE user_id = $1 AND delivered = false AND seq > $2
+		ORDER BY seq ASC
+		LIMIT $3`, userID, after, limit)
+}
+
+// GetSince возвращает уведомления пользователя с номером больше since, по возрастанию номера
+func (r *NotificationRepository) GetSince(ctx context.Context, userID uuid.UUID, since int64, limit int) ([]*Notification, error) {
+	return r.query(ctx, `
+		SELECT id, user_id, seq, type, payload, delivered, read, created_at
+		FROM notifications
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq ASC
+		LIMIT $3`, userID, since, limit)
+}
+
+// GetNotificationsByUserID возвращает последние уведомления пользователя
+func (r *NotificationRepository) GetNotificationsByUserID(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit int) ([]*Notification, error) {
+	return r.query(ctx, `
+		SELECT id, user_id, seq, type, payload, delivered, read, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read = false)
+		ORDER BY seq DESC
+		LIMIT $3`, userID, unreadOnly, limit)
+}
+
+// MarkRead отмечает уведомления пользователя прочитанными. Пустой ids означает "все".
+func (r *NotificationRepository) MarkRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE notifications
+		SET read = true
+		WHERE user_id = $1 AND read = false AND (cardinality($2::uuid[]) = 0 OR id = ANY($2::uuid[]))`,
+		userID, pq.Array(uuidStrings(ids)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *NotificationRepository) query(ctx context.Context, query string, args ...interface{}) ([]*Notification, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notifications []*Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Seq, &n.Type, &n.Payload, &n.Delivered, &n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &n)
+	}
+	return notifications, rows.Err()
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, id.String())
+	}
+	return res
+}
@@ -3,13 +3,30 @@ package storage
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
+	"gozon/platform/contracts"
+	"gozon/platform/events"
+	"gozon/platform/outbox"
+
 	"github.com/google/uuid"
 )
 
+// Топики событий, которые orders публикует через outbox
+const (
+	TopicOrdersCreated = "orders.created"
+)
+
+// OutboxTopics — все топики outbox сервиса заказов
+var OutboxTopics = []string{TopicOrdersCreated}
+
+// Атрибуты CloudEvents событий сервиса заказов
+const (
+	EventSource           = "/gozon/orders"
+	EventTypeOrderCreated = "gozon.order.created"
+)
+
 type Order struct {
 	ID          uuid.UUID `json:"id"`
 	UserID      uuid.UUID `json:"user_id"`
@@ -20,10 +37,12 @@ type Order struct {
 
 type OrderRepository struct {
 	db *sql.DB
+	// formats — формат данных событий по топику outbox
+	formats events.Formats
 }
 
-func NewOrderRepository(db *sql.DB) *OrderRepository {
-	return &OrderRepository{db: db}
+func NewOrderRepository(db *sql.DB, formats events.Formats) *OrderRepository {
+	return &OrderRepository{db: db, formats: formats}
 }
 
 // CreateOrderWithOutbox создает заказ и запись в outbox в ОДНОЙ транзакции.
@@ -43,21 +62,18 @@ func (r *OrderRepository) CreateOrderWithOutbox(ctx context.Context, order *Orde
 	}
 
 	// Формируем событие для Kafka
-	eventPayload := map[string]interface{}{
-		"order_id": order.ID,
-		"user_id":  order.UserID,
-		"amount":   order.Amount,
+	event, err := events.NewAs(r.formats.For(TopicOrdersCreated), EventSource, EventTypeOrderCreated, order.ID.String(), &contracts.OrderCreatedEvent{
+		OrderID: order.ID,
+		UserID:  order.UserID,
+		Amount:  order.Amount,
+	})
+	if err != nil {
+		return err
 	}
-	payloadBytes, _ := json.Marshal(eventPayload)
 
-	// Сохраняем событие в Outbox таблицу
-	outboxID := uuid.New()
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO outbox (id, topic, payload, created_at, processed)
-		VALUES ($1, $2, $3, $4, $5)`,
-		outboxID, "orders.created", payloadBytes, time.Now(), false,
-	)
-	if err != nil {
+	// Сохраняем событие в Outbox таблицу. Ключ — пользователь: списания по одному счету
+	// приходят в payments по порядку
+	if err := outbox.Write(ctx, tx, TopicOrdersCreated, order.UserID.String(), event); err != nil {
 		return fmt.Errorf("ошибка вставки в outbox: %w", err)
 	}
 	if err := tx.Commit(); err != nil {
@@ -87,3 +103,19 @@ func (r *OrderRepository) GetOrdersByUserID(ctx context.Context, userID uuid.UUI
 	}
 	return orders, nil
 }
+
+// GetOrderByID возвращает заказ или ErrNotFound
+func (r *OrderRepository) GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error) {
+	var o Order
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, amount, description, status
+		FROM orders
+		WHERE id = $1`, id).Scan(&o.ID, &o.UserID, &o.Amount, &o.Description, &o.Status)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
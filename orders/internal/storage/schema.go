@@ -3,6 +3,8 @@ package storage
 import (
 	"database/sql"
 	"log"
+
+	"gozon/platform/outbox"
 )
 
 // InitSchema создает таблицы, если их нет.
@@ -16,18 +18,68 @@ func InitSchema(db *sql.DB) {
         status VARCHAR(50) NOT NULL,
         created_at TIMESTAMP DEFAULT NOW()
     );
+    ` + outbox.Schema + `
+
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id UUID PRIMARY KEY,
+        -- Пользователь, зарегистрировавший вебхук: он видит и получает только свои события
+        owner_id UUID,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        event_types TEXT[] NOT NULL,
+        active BOOLEAN DEFAULT TRUE,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
 
-    CREATE TABLE IF NOT EXISTS outbox (
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
         id UUID PRIMARY KEY,
-        topic VARCHAR(100) NOT NULL,
+        webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+        -- ID события Kafka, породившего доставку: повторно доставленное событие не дублирует вебхук
+        event_id TEXT,
+        event_type VARCHAR(100) NOT NULL,
         payload JSONB NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+        attempts INT NOT NULL DEFAULT 0,
+        last_error TEXT,
+        next_attempt_at TIMESTAMP DEFAULT NOW(),
         created_at TIMESTAMP DEFAULT NOW(),
-        processed BOOLEAN DEFAULT FALSE
+        delivered_at TIMESTAMP,
+        -- Диспетчер, который арендовал доставку: результат попытки записывает только он
+        locked_by TEXT,
+        UNIQUE (webhook_id, event_id)
     );
+
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+        ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+
+    CREATE INDEX IF NOT EXISTS idx_webhooks_owner ON webhooks (owner_id);
+
+    CREATE TABLE IF NOT EXISTS notifications (
+        id UUID PRIMARY KEY,
+        user_id UUID NOT NULL,
+        type VARCHAR(50) NOT NULL,
+        payload JSONB NOT NULL,
+        delivered BOOLEAN DEFAULT FALSE,
+        read BOOLEAN DEFAULT FALSE,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_notifications_user
+        ON notifications (user_id, created_at);
+
+    -- Последний выданный номер в потоке событий пользователя
+    CREATE TABLE IF NOT EXISTS notification_sequences (
+        user_id UUID PRIMARY KEY,
+        last_seq BIGINT NOT NULL
+    );
+
+    ALTER TABLE notifications ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+    CREATE INDEX IF NOT EXISTS idx_notifications_user_seq
+        ON notifications (user_id, seq);
     `
 	_, err := db.Exec(query)
 	if err != nil {
 		log.Fatalf("Ошибка инициализации схемы БД: %v", err)
 	}
-	log.Println("Схема БД успешно инициализирована (Orders + Outbox)")
+	log.Println("Схема БД успешно инициализирована (Orders + Outbox + Webhooks + Notifications)")
 }
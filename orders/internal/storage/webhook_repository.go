@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// EventOrderStatusChanged отправляется при каждом изменении статуса заказа
+const EventOrderStatusChanged = "order.status_changed"
+
+// WebhookEventTypes перечисляет события, на которые можно подписать вебхук
+var WebhookEventTypes = []string{EventOrderStatusChanged}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryDead      = "DEAD"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrLeaseLost — аренда доставки истекла, и ее взял другой диспетчер
+var ErrLeaseLost = errors.New("delivery lease lost")
+
+type Webhook struct {
+	ID         uuid.UUID `json:"id"`
+	OwnerID    uuid.UUID `json:"owner_id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID       `json:"id"`
+	WebhookID     uuid.UUID       `json:"webhook_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+
+	// Заполняются только при захвате доставки диспетчером
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateWebhook регистрирует новый endpoint
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, wh *Webhook) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (id, owner_id, url, secret, event_types, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`,
+		wh.ID, wh.OwnerID, wh.URL, wh.Secret, pq.Array(wh.EventTypes), wh.Active,
+	).Scan(&wh.CreatedAt)
+}
+
+// ListWebhooks возвращает endpoint'ы владельца без секретов
+func (r *WebhookRepository) ListWebhooks(ctx context.Context, ownerID uuid.UUID) ([]*Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, owner_id, url, event_types, active, created_at
+		FROM webhooks
+		WHERE owner_id = $1
+		ORDER BY created_at ASC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []*Webhook
+	for rows.Next() {
+		var wh Webhook
+		if err := rows.Scan(&wh.ID, &wh.OwnerID, &wh.URL, pq.Array(&wh.EventTypes), &wh.Active, &wh.CreatedAt); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, &wh)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook удаляет endpoint владельца вместе с его очередью доставок
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, id, ownerID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1 AND owner_id = $2", id, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnqueueDeliveries ставит событие пользователя ownerID в очередь для его подписанных вебхуков.
+// Вызывается внутри транзакции, которая меняет состояние заказа. eventID — ID события Kafka,
+// вызвавшего изменение: при его повторной доставке доставки не дублируются. Пустой eventID
+// (сообщение без конверта) не дедуплицируется.
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, tx *sql.Tx, ownerID, eventID, eventType string, payload []byte) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload)
+		SELECT gen_random_uuid(), id, NULLIF($4, ''), $1, $2
+		FROM webhooks
+		WHERE active AND $1 = ANY(event_types) AND owner_id = $3
+		ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+		eventType, payload, ownerID, eventID,
+	)
+	return err
+}
+
+// ClaimDueDeliveries забирает доставки, время которых пришло, сдвигает next_attempt_at на lease,
+// чтобы другие инстансы не взяли их повторно, и записывает владельца аренды в locked_by.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration, lockedBy string) ([]*WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2), locked_by = $3
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'PENDING' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret`,
+		limit, lease.Seconds(), lockedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Attempts, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Status = DeliveryPending
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkDelivered фиксирует успешную доставку, если аренда все еще принадлежит lockedBy
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id uuid.UUID, lockedBy string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'DELIVERED', attempts = attempts + 1, last_error = NULL, delivered_at = NOW(), locked_by = NULL
+		WHERE id = $1 AND locked_by = $2`, id, lockedBy)
+	return leaseResult(res, err)
+}
+
+// MarkFailed фиксирует неудачную попытку, если аренда все еще принадлежит lockedBy.
+// Если dead = true, доставка уходит в dead-letter.
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id uuid.UUID, lockedBy, lastErr string, nextAttempt time.Time, dead bool) error {
+	status := DeliveryPending
+	if dead {
+		status = DeliveryDead
+	}
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $3, attempts = attempts + 1, last_error = $4, next_attempt_at = $5, locked_by = NULL
+		WHERE id = $1 AND locked_by = $2`,
+		id, lockedBy, status, lastErr, nextAttempt,
+	)
+	return leaseResult(res, err)
+}
+
+func leaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ListDeadDeliveries возвращает доставки вебхуков владельца, исчерпавшие все попытки
+func (r *WebhookRepository) ListDeadDeliveries(ctx context.Context, ownerID uuid.UUID, limit int) ([]*WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, COALESCE(d.last_error, ''),
+			d.next_attempt_at, d.created_at
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'DEAD' AND w.owner_id = $1
+		ORDER BY d.created_at DESC
+		LIMIT $2`, ownerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.LastError, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RequeueDeadDeliveries возвращает dead-доставки вебхуков владельца в очередь со сброшенным
+// счетчиком попыток. Пустой ids означает "все dead-доставки владельца".
+func (r *WebhookRepository) RequeueDeadDeliveries(ctx context.Context, ownerID uuid.UUID, ids []uuid.UUID) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'PENDING', attempts = 0, next_attempt_at = NOW()
+		WHERE status = 'DEAD' AND (cardinality($1::uuid[]) = 0 OR id = ANY($1::uuid[]))
+		  AND webhook_id IN (SELECT id FROM webhooks WHERE owner_id = $2)`,
+		pq.Array(uuidStrings(ids)), ownerID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
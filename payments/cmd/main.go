@@ -11,8 +11,12 @@ import (
 	_ "gozon/payments/docs"
 	"gozon/payments/internal/service"
 	"gozon/payments/internal/storage"
-
-	"gozon/payments/internal/broker"
+	"gozon/platform/admin"
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+	"gozon/platform/events"
+	"gozon/platform/outbox"
+	"gozon/platform/retention"
 
 	_ "github.com/lib/pq"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -26,6 +30,10 @@ import (
 // @host      localhost:8081
 // @BasePath  /
 
+// @securityDefinitions.apikey  AdminToken
+// @in                          header
+// @name                        X-Admin-Token
+
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
@@ -44,11 +52,34 @@ func main() {
 	if kafkaBrokers == "" {
 		kafkaBrokers = "localhost:9092"
 	}
-	processor := service.NewPaymentProcessor(kafkaBrokers, db)
+	// EVENT_FORMATS выбирает формат данных по топику, например "payments.processed=protobuf"; по умолчанию JSON
+	formats, err := events.FormatsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Kafka Producer: relay outbox и dead-letter консьюмера
+	producer := broker.NewProducer(kafkaBrokers)
+	defer producer.Close()
+	workers, err := consumer.WorkersFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ordersRetry, err := consumer.RetryConfigFromEnv(service.TopicOrdersCreated, "ORDERS_CREATED_DLQ_TOPIC")
+	if err != nil {
+		log.Fatal(err)
+	}
+	processor := service.NewPaymentProcessor(kafkaBrokers, db, producer, ordersRetry, workers, formats)
 	go processor.Start(context.Background())
-	// Kafka Producer + Relay
-	producer := broker.NewProducer(kafkaBrokers, "payments.processed")
-	go service.StartRelay(context.Background(), db, producer)
+	// Relay: один релей на все топики outbox
+	// OUTBOX_RELAY_MODE=cdc читает outbox из логической репликации (нужен wal_level=logical)
+	if err := outbox.StartFromEnv(context.Background(), db, dbConnStr, producer, storage.OutboxTopics); err != nil {
+		log.Fatal(err)
+	}
+	retentionCfg, err := retention.ConfigFromEnv(true)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go retention.NewCleaner(db, retentionCfg).Start(context.Background())
 
 	// HTTP Handler
 	h := handler.NewHandler(db)
@@ -58,6 +89,9 @@ func main() {
 	http.HandleFunc("/api/payments/deposit", h.Deposit)
 	http.HandleFunc("/api/payments/balance", h.GetBalance)
 
+	// Служебные маршруты: только на порту сервиса (gateway их не проксирует) и с ADMIN_TOKEN
+	admin.Register(admin.TokenFromEnv(), db, kafkaBrokers, producer, ordersRetry.DeadLetter.Topic)
+
 	// Swagger
 	http.HandleFunc("/swagger/", httpSwagger.WrapHandler)
 
@@ -116,6 +116,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "Account not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Error",
                         "schema": {
@@ -124,9 +130,269 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/internal/dlq": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Возвращает последние сообщения, которые консьюмер не смог обработать. Без topic — список DLQ-топиков сервиса.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Сообщения dead-letter топика",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "DLQ-топик",
+                        "name": "topic",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Количество сообщений (по умолчанию 50)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.DeadLetter"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный токен администратора",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/internal/dlq/redrive": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Переотправляет сообщения DLQ в исходный топик. Прогресс запоминается, повторный вызов продолжает с места остановки.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Повтор сообщений dead-letter топика",
+                "parameters": [
+                    {
+                        "description": "DLQ-топик",
+                        "name": "input",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.RedriveRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный токен администратора",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/internal/outbox/dead-letters": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Возвращает события, которые relay не смог отправить в Kafka за все попытки",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Dead-letter сообщения outbox",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/admin.DeadOutboxMessage"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный токен администратора",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/internal/outbox/dead-letters/replay": {
+            "post": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Возвращает dead-сообщения в очередь relay со сброшенным счетчиком попыток",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Повтор dead-letter сообщений outbox",
+                "parameters": [
+                    {
+                        "description": "ID сообщений",
+                        "name": "input",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/admin.RequeueOutboxRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer",
+                                "format": "int64"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Нет или неверный токен администратора",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "admin.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "headers": {
+                    "description": "Headers — заголовки CloudEvents и dlq_* (причина, попытки, исходные топик/партиция/offset)",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "key": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "partition": {
+                    "type": "integer"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value — исходные данные сообщения (base64)",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "admin.DeadOutboxMessage": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "content_type": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload — JSON-данные или base64-строка для бинарных форматов",
+                    "type": "object"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.RedriveRequest": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "description": "Limit — сколько сообщений вернуть за вызов, по умолчанию 100",
+                    "type": "integer"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.RequeueOutboxRequest": {
+            "type": "object",
+            "properties": {
+                "message_ids": {
+                    "description": "Пустой список означает повтор всех dead-сообщений",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "handler.AccountRequest": {
             "type": "object",
             "properties": {
@@ -147,6 +413,13 @@ const docTemplate = `{
             }
         }
     },
+    "securityDefinitions": {
+        "AdminToken": {
+            "type": "apiKey",
+            "name": "X-Admin-Token",
+            "in": "header"
+        }
+    },
     "externalDocs": {
         "description": "OpenAPI",
         "url": "https://swagger.io/resources/open-api/"
@@ -1,42 +0,0 @@
-package broker
-
-import (
-	"context"
-	"log"
-	"time"
-
-	"github.com/segmentio/kafka-go"
-)
-
-type Producer struct {
-	writer *kafka.Writer
-}
-
-func NewProducer(brokers string, topic string) *Producer {
-	writer := &kafka.Writer{
-		Addr:                   kafka.TCP(brokers),
-		Topic:                  topic,
-		Balancer:               &kafka.LeastBytes{},
-		AllowAutoTopicCreation: true,
-		RequiredAcks:           kafka.RequireAll,
-		BatchTimeout:           10 * time.Millisecond,
-		BatchSize:              1,
-	}
-	log.Printf("Kafka Producer initialized for topic: %s at %s", topic, brokers)
-	return &Producer{
-		writer: writer,
-	}
-}
-
-func (p *Producer) SendMessage(ctx context.Context, key string, value []byte) error {
-	msg := kafka.Message{
-		Key:   []byte(key),
-		Value: value,
-		Time:  time.Now(),
-	}
-	return p.writer.WriteMessages(ctx, msg)
-}
-
-func (p *Producer) Close() error {
-	return p.writer.Close()
-}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"gozon/payments/internal/storage"
+	"gozon/platform/contracts"
+
 	"github.com/google/uuid"
 )
 
@@ -58,6 +61,7 @@ func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        input body DepositRequest true "Данные пополнения"
 // @Success      200  {string}  string "Updated"
+// @Failure      404  {string}  string "Account not found"
 // @Failure      500  {string}  string "Error"
 // @Router       /api/payments/deposit [post]
 func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
@@ -70,7 +74,34 @@ func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Amount must be positive", http.StatusBadRequest)
 		return
 	}
-	_, err := h.db.Exec("UPDATE accounts SET balance = balance + $1 WHERE user_id = $2", req.Amount, req.UserID)
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "Error updating balance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var balance int64
+	err = tx.QueryRowContext(r.Context(),
+		"UPDATE accounts SET balance = balance + $1 WHERE user_id = $2 RETURNING balance", req.Amount, req.UserID,
+	).Scan(&balance)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating balance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Новый баланс уходит подписчикам через outbox в той же транзакции
+	err = storage.InsertBalanceChanged(r.Context(), tx, contracts.BalanceChangedEvent{
+		UserID:  req.UserID,
+		Balance: balance,
+		Delta:   req.Amount,
+		Reason:  contracts.BalanceReasonDeposit,
+	}, "")
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		http.Error(w, "Error updating balance: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -3,92 +3,87 @@ package service
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
-	"time"
+
+	"gozon/payments/internal/storage"
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+	"gozon/platform/contracts"
+	"gozon/platform/events"
+	"gozon/platform/inbox"
+	"gozon/platform/outbox"
 
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
 
-type OrderCreatedEvent struct {
-	OrderID uuid.UUID `json:"order_id"`
-	UserID  uuid.UUID `json:"user_id"`
-	Amount  int64     `json:"amount"`
-}
+// eventTypeOrderCreated — тип события orders о новом заказе
+const eventTypeOrderCreated = "gozon.order.created"
 
 type PaymentProcessor struct {
-	db     *sql.DB
-	reader *kafka.Reader
+	consumer *consumer.Group
+	// formats — формат данных событий по топику outbox
+	formats events.Formats
 }
 
-func NewPaymentProcessor(brokers string, db *sql.DB) *PaymentProcessor {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  []string{brokers},
-		Topic:    "orders.created",
-		GroupID:  "payments-group",
-		MinBytes: 1,
-		MaxBytes: 10e6,
-		MaxWait:  10 * time.Millisecond,
-	})
-	return &PaymentProcessor{db: db, reader: reader}
+// NewPaymentProcessor собирает консьюмер orders.created. Сообщение, не обработанное за
+// всех уровней повтора retry, уходит в dead-letter топик.
+func NewPaymentProcessor(brokers string, db *sql.DB, producer *broker.Producer, retry consumer.RetryConfig, workers int,
+	formats events.Formats) *PaymentProcessor {
+	p := &PaymentProcessor{formats: formats}
+	pay := inbox.Dedup(db, orderKey)(p.processMessage)
+	p.consumer = consumer.NewWithRetries(consumer.Config{
+		Name:    "Payments Consumer",
+		Brokers: brokers,
+		Topic:   TopicOrdersCreated,
+		GroupID: "payments-group",
+		// Ключ orders.created — пользователь: списания с одного счета не выполняются параллельно
+		Workers: workers,
+	}, producer, retry, consumer.Dispatch(map[string]consumer.Handler{
+		eventTypeOrderCreated: pay,
+		"":                    pay,
+	}), consumer.Recover())
+	return p
 }
 
 func (p *PaymentProcessor) Start(ctx context.Context) {
-	log.Println("Payments Consumer started...")
-	for {
-		// Читаем сообщение из Kafka
-		m, err := p.reader.FetchMessage(ctx)
-		if err != nil {
-			log.Printf("Error fetching message: %v", err)
-			continue
-		}
-		if err := p.processMessage(ctx, m); err != nil {
-			log.Printf("Error processing message: %v", err)
-		} else {
-			p.reader.CommitMessages(ctx, m)
-			log.Printf("Order processed successfully. Offset: %d", m.Offset)
-		}
+	p.consumer.Start(ctx)
+}
+
+// orderKey — ключ дедупликации: заказ оплачивается не больше одного раза
+func orderKey(m kafka.Message) (uuid.UUID, error) {
+	var event contracts.OrderCreatedEvent
+	if err := schemas.Decode(eventTypeOrderCreated, events.FromKafka(m), &event); err != nil {
+		return uuid.Nil, err
 	}
+	return event.OrderID, nil
 }
 
+// processMessage выполняется в транзакции inbox.Dedup: списание, outbox и запись в inbox атомарны
 func (p *PaymentProcessor) processMessage(ctx context.Context, m kafka.Message) error {
-	var event OrderCreatedEvent
-	if err := json.Unmarshal(m.Value, &event); err != nil {
-		return fmt.Errorf("bad json: %w", err)
-	}
-	msgKey := event.OrderID
-	tx, err := p.db.BeginTx(ctx, nil)
-	if err != nil {
+	incoming := events.FromKafka(m)
+	var event contracts.OrderCreatedEvent
+	if err := schemas.Decode(eventTypeOrderCreated, incoming, &event); err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	// Inbox
-	// Проверяем, обрабатывали ли мы этот заказ
-	var exists int
-	err = tx.QueryRowContext(ctx, "SELECT 1 FROM inbox WHERE msg_id = $1", msgKey).Scan(&exists)
-	if err == nil {
-		log.Printf("Duplicate message ignored: %s", msgKey)
-		return tx.Commit()
-	}
+	tx := inbox.TxFromContext(ctx)
 
 	// Бизнес-логика
 	// Пытаемся списать деньги. Возвращаем user_id, если списание прошло.
 	// balance >= $2 гарантирует, что мы не уйдем в минус.
-	var uid string
-	err = tx.QueryRowContext(ctx, `
+	var balance int64
+	err := tx.QueryRowContext(ctx, `
 		UPDATE accounts 
 		SET balance = balance - $1 
 		WHERE user_id = $2 AND balance >= $1
-		RETURNING user_id`,
+		RETURNING balance`,
 		event.Amount, event.UserID,
-	).Scan(&uid)
+	).Scan(&balance)
 
-	status := "FINISHED"
+	status := contracts.PaymentFinished
 	if err == sql.ErrNoRows {
-		status = "CANCELLED"
+		status = contracts.PaymentCancelled
 		log.Printf("Payment failed for order %s: Insufficient funds or no user", event.OrderID)
 	} else if err != nil {
 		return fmt.Errorf("db error: %w", err)
@@ -96,22 +91,29 @@ func (p *PaymentProcessor) processMessage(ctx context.Context, m kafka.Message)
 
 	// Outbox
 	// Готовим ответ для Order Service
-	replyPayload, _ := json.Marshal(map[string]interface{}{
-		"order_id": event.OrderID,
-		"status":   status,
-	})
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO outbox (id, topic, payload) VALUES ($1, $2, $3)`,
-		uuid.New(), "payments.processed", replyPayload,
-	)
+	reply, err := events.NewAs(p.formats.For(storage.TopicPaymentsProcessed), storage.EventSource,
+		storage.EventTypePaymentProcessed, event.OrderID.String(),
+		&contracts.PaymentStatusEvent{OrderID: event.OrderID, Status: status})
 	if err != nil {
+		return err
+	}
+	reply = reply.CausedBy(incoming)
+	if err := outbox.Write(ctx, tx, storage.TopicPaymentsProcessed, event.OrderID.String(), reply); err != nil {
 		return fmt.Errorf("outbox error: %w", err)
 	}
-
-	// Запись в Inbox
-	_, err = tx.ExecContext(ctx, "INSERT INTO inbox (msg_id) VALUES ($1)", msgKey)
-	if err != nil {
-		return fmt.Errorf("inbox write error: %w", err)
+	if status == contracts.PaymentFinished {
+		err = storage.InsertBalanceChanged(ctx, tx, contracts.BalanceChangedEvent{
+			UserID:  event.UserID,
+			Balance: balance,
+			Delta:   -event.Amount,
+			Reason:  contracts.BalanceReasonOrderPayment,
+			OrderID: &event.OrderID,
+		}, incoming.ID)
+		if err != nil {
+			return fmt.Errorf("outbox error: %w", err)
+		}
 	}
-	return tx.Commit()
+
+	log.Printf("Order %s processed: %s", event.OrderID, status)
+	return nil
 }
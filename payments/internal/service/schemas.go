@@ -0,0 +1,11 @@
+package service
+
+import "gozon/platform/events"
+
+// schemas — текущие версии событий, которые читает сервис платежей. При изменении схемы
+// версия поднимается, а для старой регистрируется upcaster.
+var schemas = events.NewRegistry().
+	Register(eventTypeOrderCreated, 1, nil)
+
+// TopicOrdersCreated — топик orders, который читает сервис платежей
+const TopicOrdersCreated = "orders.created"
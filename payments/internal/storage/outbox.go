@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"gozon/platform/contracts"
+	"gozon/platform/events"
+	"gozon/platform/outbox"
+)
+
+// Топики событий, которые payments публикует через outbox
+const (
+	TopicPaymentsProcessed = "payments.processed"
+	TopicBalanceChanged    = "payments.balance_changed"
+)
+
+// OutboxTopics — все топики outbox сервиса платежей
+var OutboxTopics = []string{TopicPaymentsProcessed, TopicBalanceChanged}
+
+// Атрибуты CloudEvents событий сервиса платежей
+const (
+	EventSource               = "/gozon/payments"
+	EventTypePaymentProcessed = "gozon.payment.processed"
+	EventTypeBalanceChanged   = "gozon.balance.changed"
+)
+
+// InsertBalanceChanged публикует новое значение баланса через outbox.
+// Ключ — пользователь, чтобы значения баланса не приходили вразнобой.
+// causationID — ID события, вызвавшего изменение (пусто для пополнения через API).
+func InsertBalanceChanged(ctx context.Context, tx *sql.Tx, event contracts.BalanceChangedEvent, causationID string) error {
+	ev, err := events.New(EventSource, EventTypeBalanceChanged, event.UserID.String(), event)
+	if err != nil {
+		return err
+	}
+	ev.CausationID = causationID
+	return outbox.Write(ctx, tx, TopicBalanceChanged, event.UserID.String(), ev)
+}
@@ -0,0 +1,54 @@
+// Package admin — служебные HTTP-обработчики сервисов: dead-letter outbox и топиков консьюмеров.
+// Маршруты регистрируются под /internal/ на порту сервиса и не проксируются gateway'ем,
+// а каждый запрос требует токен администратора.
+package admin
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+
+	"gozon/platform/broker"
+)
+
+// HeaderToken — заголовок с токеном администратора
+const HeaderToken = "X-Admin-Token"
+
+// RequireToken пропускает запрос только с заголовком X-Admin-Token, равным token.
+// Пустой token отключает обработчик: без настроенного токена админка закрыта.
+func RequireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Admin API is disabled: ADMIN_TOKEN is not set", http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(HeaderToken)), []byte(token)) != 1 {
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// TokenFromEnv возвращает ADMIN_TOKEN и предупреждает в логе, если он не задан
+func TokenFromEnv() string {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		log.Println("WARNING: ADMIN_TOKEN is not set, /internal/ admin endpoints are disabled")
+	}
+	return token
+}
+
+// Register регистрирует общие служебные маршруты сервиса в http.DefaultServeMux: dead-letter outbox
+// и dead-letter топики консьюмеров dlqTopics
+func Register(token string, db *sql.DB, brokers string, producer *broker.Producer, dlqTopics ...string) {
+	oh := NewOutboxHandler(db)
+	http.HandleFunc("/internal/outbox/dead-letters", RequireToken(token, oh.GetDeadMessages))
+	http.HandleFunc("/internal/outbox/dead-letters/replay", RequireToken(token, oh.RequeueDeadMessages))
+
+	dh := NewDLQHandler(brokers, producer, dlqTopics...)
+	http.HandleFunc("/internal/dlq", RequireToken(token, dh.GetDeadLetters))
+	http.HandleFunc("/internal/dlq/redrive", RequireToken(token, dh.RedriveDeadLetters))
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"gozon/platform/broker"
+	"gozon/platform/consumer"
+)
+
+// DeadLetter повторяет consumer.DeadLetterMessage с JSON-тегами
+type DeadLetter struct {
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       string `json:"key"`
+	// Value — исходные данные сообщения (base64)
+	Value []byte `json:"value"`
+	// Headers — заголовки CloudEvents и dlq_* (причина, попытки, исходные топик/партиция/offset)
+	Headers map[string]string `json:"headers"`
+	Time    time.Time         `json:"time"`
+}
+
+type RedriveRequest struct {
+	Topic string `json:"topic"`
+	// Limit — сколько сообщений вернуть за вызов, по умолчанию 100
+	Limit int `json:"limit"`
+}
+
+type DLQHandler struct {
+	brokers  string
+	producer *broker.Producer
+	// topics — dead-letter топики консьюмеров сервиса
+	topics []string
+}
+
+func NewDLQHandler(brokers string, producer *broker.Producer, topics ...string) *DLQHandler {
+	return &DLQHandler{brokers: brokers, producer: producer, topics: topics}
+}
+
+// GetDeadLetters godoc
+// @Summary      Сообщения dead-letter топика
+// @Description  Возвращает последние сообщения, которые консьюмер не смог обработать. Без topic — список DLQ-топиков сервиса.
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Param        topic  query  string  false  "DLQ-топик"
+// @Param        limit  query  int     false  "Количество сообщений (по умолчанию 50)"
+// @Success      200  {array}  DeadLetter
+// @Failure      401  {string}  string "Нет или неверный токен администратора"
+// @Router       /internal/dlq [get]
+func (h *DLQHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"topics": h.topics})
+		return
+	}
+	if !slices.Contains(h.topics, topic) {
+		http.Error(w, "Unknown dead-letter topic", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	messages, err := consumer.ListDeadLetters(r.Context(), h.brokers, topic, limit)
+	if err != nil {
+		http.Error(w, "Kafka error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := make([]DeadLetter, len(messages))
+	for i, m := range messages {
+		res[i] = DeadLetter(*m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// RedriveDeadLetters godoc
+// @Summary      Повтор сообщений dead-letter топика
+// @Description  Переотправляет сообщения DLQ в исходный топик. Прогресс запоминается, повторный вызов продолжает с места остановки.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        input body RedriveRequest true "DLQ-топик"
+// @Success      200  {object}  map[string]int
+// @Failure      401  {string}  string "Нет или неверный токен администратора"
+// @Router       /internal/dlq/redrive [post]
+func (h *DLQHandler) RedriveDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req RedriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(h.topics, req.Topic) {
+		http.Error(w, "Unknown dead-letter topic", http.StatusBadRequest)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	n, err := consumer.Redrive(r.Context(), h.brokers, h.producer, req.Topic, req.Topic+".redrive", req.Limit)
+	if err != nil {
+		http.Error(w, "Kafka error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"redriven": n})
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gozon/platform/outbox"
+
+	"github.com/google/uuid"
+)
+
+type RequeueOutboxRequest struct {
+	// Пустой список означает повтор всех dead-сообщений
+	MessageIDs []uuid.UUID `json:"message_ids"`
+}
+
+// DeadOutboxMessage повторяет outbox.DeadMessage с JSON-тегами
+type DeadOutboxMessage struct {
+	ID    uuid.UUID `json:"id"`
+	Topic string    `json:"topic"`
+	// Payload — JSON-данные или base64-строка для бинарных форматов
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	ContentType string          `json:"content_type"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type OutboxHandler struct {
+	db *sql.DB
+}
+
+func NewOutboxHandler(db *sql.DB) *OutboxHandler {
+	return &OutboxHandler{db: db}
+}
+
+// GetDeadMessages godoc
+// @Summary      Dead-letter сообщения outbox
+// @Description  Возвращает события, которые relay не смог отправить в Kafka за все попытки
+// @Tags         admin
+// @Produce      json
+// @Security     AdminToken
+// @Success      200  {array}  DeadOutboxMessage
+// @Failure      401  {string}  string "Нет или неверный токен администратора"
+// @Router       /internal/outbox/dead-letters [get]
+func (h *OutboxHandler) GetDeadMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := outbox.ListDead(r.Context(), h.db, 100)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := make([]DeadOutboxMessage, len(messages))
+	for i, m := range messages {
+		res[i] = DeadOutboxMessage(*m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// RequeueDeadMessages godoc
+// @Summary      Повтор dead-letter сообщений outbox
+// @Description  Возвращает dead-сообщения в очередь relay со сброшенным счетчиком попыток
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     AdminToken
+// @Param        input body RequeueOutboxRequest false "ID сообщений"
+// @Success      200  {object}  map[string]int64
+// @Failure      401  {string}  string "Нет или неверный токен администратора"
+// @Router       /internal/outbox/dead-letters/replay [post]
+func (h *OutboxHandler) RequeueDeadMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req RequeueOutboxRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Неверный формат JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	n, err := outbox.RequeueDead(r.Context(), h.db, req.MessageIDs)
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"requeued": n})
+}
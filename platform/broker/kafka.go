@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Message — сообщение для пакетной отправки
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+}
+
+// Producer пишет в любой топик: топик задается в каждом сообщении
+type Producer struct {
+	writer  *kafka.Writer
+	brokers string
+}
+
+func NewProducer(brokers string) *Producer {
+	writer := &kafka.Writer{
+		Addr: kafka.TCP(brokers),
+		// Hash: сообщения с одним ключом попадают в одну партицию и сохраняют порядок
+		Balancer:               &kafka.Hash{},
+		AllowAutoTopicCreation: true,
+		RequiredAcks:           kafka.RequireAll,
+		BatchTimeout:           10 * time.Millisecond,
+	}
+	log.Printf("Kafka Producer initialized at %s", brokers)
+	return &Producer{writer: writer, brokers: brokers}
+}
+
+// SendBatch отправляет сообщения одним вызовом WriteMessages. Возвращает nil при полном успехе,
+// иначе срез ошибок по индексам msgs (nil — сообщение записано).
+func (p *Producer) SendBatch(ctx context.Context, msgs []Message) []error {
+	batch := make([]kafka.Message, len(msgs))
+	now := time.Now()
+	for i, m := range msgs {
+		batch[i] = kafka.Message{Topic: m.Topic, Key: []byte(m.Key), Value: m.Value, Headers: kafkaHeaders(m.Headers), Time: now}
+	}
+	err := p.writer.WriteMessages(ctx, batch...)
+	if err == nil {
+		return nil
+	}
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == len(msgs) {
+		return writeErrs
+	}
+	errs := make([]error, len(msgs))
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func kafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]kafka.Header, 0, len(headers))
+	for k, v := range headers {
+		out = append(out, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return out
+}
+
+// EnsureTopics создает недостающие топики через контроллер кластера. Существующие не меняются.
+func (p *Producer) EnsureTopics(partitions, replicationFactor int, topics ...string) error {
+	conn, err := kafka.Dial("tcp", p.brokers)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		return err
+	}
+	ctrl, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return err
+	}
+	defer ctrl.Close()
+
+	configs := make([]kafka.TopicConfig, len(topics))
+	for i, t := range topics {
+		configs[i] = kafka.TopicConfig{Topic: t, NumPartitions: partitions, ReplicationFactor: replicationFactor}
+	}
+	return ctrl.CreateTopics(configs...)
+}
+
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,160 @@
+// Package consumer — цикл чтения Kafka с цепочкой middleware вокруг обработчика сообщения.
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gozon/platform/events"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler обрабатывает одно сообщение. Ошибка не пропускает сообщение: консьюмер повторяет его
+// на месте с растущей паузой, и партиция ждет. Уводить из партиции сообщения, которые не
+// обрабатываются, — задача middleware повторов и dead-letter (NewWithRetries, DeadLetter).
+type Handler func(ctx context.Context, m kafka.Message) error
+
+// Middleware оборачивает Handler: дедупликация, восстановление после паники и т.п.
+type Middleware func(Handler) Handler
+
+type Config struct {
+	// Name используется в логах
+	Name    string
+	Brokers string
+	Topic   string
+	GroupID string
+	// Workers — число параллельных обработчиков. Сообщения с одним ключом (Key) идут одному
+	// воркеру и обрабатываются по порядку. 0 или 1 — последовательная обработка.
+	Workers int
+	// Key — ключ сериализации, по умолчанию ключ сообщения Kafka
+	Key func(kafka.Message) string
+}
+
+// reader — часть kafka.Reader, которой пользуется консьюмер
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// handlerBackoff — первая пауза перед повтором сообщения, на котором обработчик вернул ошибку;
+// пауза растет вдвое до maxHandlerBackoff
+const (
+	handlerBackoff    = 500 * time.Millisecond
+	maxHandlerBackoff = 30 * time.Second
+)
+
+type Consumer struct {
+	name    string
+	reader  reader
+	handler Handler
+	workers int
+	key     func(kafka.Message) string
+	backoff time.Duration
+}
+
+// New собирает консьюмер. Первый middleware в списке — внешний.
+func New(cfg Config, handler Handler, middlewares ...Middleware) *Consumer {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{cfg.Brokers},
+		Topic:    cfg.Topic,
+		GroupID:  cfg.GroupID,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+		MaxWait:  10 * time.Millisecond,
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	key := cfg.Key
+	if key == nil {
+		key = func(m kafka.Message) string { return string(m.Key) }
+	}
+	return &Consumer{name: cfg.Name, reader: reader, handler: handler, workers: cfg.Workers, key: key, backoff: handlerBackoff}
+}
+
+// Start читает сообщения до отмены ctx
+func (c *Consumer) Start(ctx context.Context) {
+	log.Printf("%s started...", c.name)
+	defer c.reader.Close()
+	if c.workers > 1 {
+		c.startPool(ctx)
+		return
+	}
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("Stopping %s...", c.name)
+				return
+			}
+			log.Printf("%s: error fetching message: %v", c.name, err)
+			continue
+		}
+		if !c.handleUntilDone(ctx, m, nil) {
+			// Остановка: сообщение не закоммичено и будет прочитано снова
+			continue
+		}
+		if err := c.reader.CommitMessages(ctx, m); err != nil {
+			log.Printf("%s: failed to commit offset %d: %v", c.name, m.Offset, err)
+		}
+	}
+}
+
+// handleUntilDone вызывает обработчик, пока тот не вернет nil. false — сообщение не обработано:
+// ctx отменен или abandoned сообщил, что партиция больше не наша.
+func (c *Consumer) handleUntilDone(ctx context.Context, m kafka.Message, abandoned func() bool) bool {
+	backoff := c.backoff
+	for {
+		err := c.handler(ctx, m)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("%s: error processing message (partition %d, offset %d), partition stalled, retrying in %s: %v",
+			c.name, m.Partition, m.Offset, backoff, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if abandoned != nil && abandoned() {
+			return false
+		}
+		backoff = min(backoff*2, maxHandlerBackoff)
+	}
+}
+
+// Recover превращает панику обработчика в ошибку, чтобы консьюмер продолжил работу
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m kafka.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// Dispatch выбирает обработчик по типу события (заголовок ce_type). Сообщения без конверта,
+// записанные до перехода на CloudEvents, идут в routes[""]. Неизвестные типы пропускаются:
+// новые виды событий в существующем топике не ломают старых потребителей.
+func Dispatch(routes map[string]Handler) Handler {
+	return func(ctx context.Context, m kafka.Message) error {
+		eventType := events.Type(m)
+		h, ok := routes[eventType]
+		if !ok {
+			log.Printf("Skipping event of unknown type %q (offset %d)", eventType, m.Offset)
+			return nil
+		}
+		return h(ctx, m)
+	}
+}
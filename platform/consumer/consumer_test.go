@@ -0,0 +1,56 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// runSerial запускает Start в последовательном режиме и возвращает функцию остановки
+func runSerial(c *Consumer) (stop func()) {
+	c.workers = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestSerialRetriesFailedMessageInPlace(t *testing.T) {
+	r := &fakeReader{msgs: messages(0, "a", "b", "c")}
+	var (
+		healed   atomic.Bool
+		failures atomic.Int32
+		handled  atomic.Int32
+	)
+	c := newTestConsumer(r, func(ctx context.Context, m kafka.Message) error {
+		if m.Offset == 1 && !healed.Load() {
+			failures.Add(1)
+			return errors.New("boom")
+		}
+		handled.Add(1)
+		return nil
+	})
+	stop := runSerial(c)
+	defer stop()
+
+	// Пока сообщение 1 падает, следующие не читаются и offset не проходит его
+	waitFor(t, "message 1 to be retried", func() bool { return failures.Load() >= 3 })
+	if n := handled.Load(); n != 1 {
+		t.Fatalf("handled %d messages while offset 1 fails, want 1", n)
+	}
+	if last := r.lastCommitted(0); last != 0 {
+		t.Fatalf("last committed offset %d while offset 1 fails, want 0", last)
+	}
+
+	healed.Store(true)
+	waitFor(t, "all offsets committed", func() bool { return r.lastCommitted(0) == 2 })
+}
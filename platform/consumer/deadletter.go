@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gozon/platform/broker"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, которые DeadLetter и уровни повтора добавляют к исходным: причина, число попыток
+// и координаты исходного сообщения (сохраняются при переходе между уровнями)
+const (
+	HeaderDLQError     = "dlq_error"
+	HeaderDLQAttempts  = "dlq_attempts"
+	HeaderDLQTopic     = "dlq_topic"
+	HeaderDLQPartition = "dlq_partition"
+	HeaderDLQOffset    = "dlq_offset"
+	HeaderDLQFailedAt  = "dlq_failed_at"
+)
+
+type DeadLetterConfig struct {
+	// Topic — dead-letter топик консьюмера
+	Topic string
+	// MaxAttempts — сколько раз обработчик вызывается до отправки сообщения в Topic.
+	// При уровнях повтора (RetryConfig.Delays) — сколько попыток делает каждый уровень.
+	MaxAttempts int
+	Backoff     time.Duration
+	// Permanent — ошибки, которые не исправятся повтором: сообщение сразу уходит в Topic
+	Permanent func(error) bool
+}
+
+// DefaultDeadLetterConfig — топик <sourceTopic>.dlq, 3 попытки; постоянные ошибки (IsPermanent) не повторяются
+func DefaultDeadLetterConfig(sourceTopic string) DeadLetterConfig {
+	return DeadLetterConfig{
+		Topic:       sourceTopic + ".dlq",
+		MaxAttempts: 3,
+		Backoff:     500 * time.Millisecond,
+		Permanent:   IsPermanent,
+	}
+}
+
+// DeadLetter повторяет обработку до MaxAttempts раз, а сообщение, которое так и не удалось
+// обработать, публикует в dead-letter топик и считает обработанным, чтобы консьюмер
+// закоммитил offset. Ключ, значение и заголовки сохраняются как есть.
+// Offset коммитится только после успешной публикации в dead-letter: при ошибке Kafka публикация
+// повторяется, пока не удастся, а при остановке сервиса возвращается ошибка и offset не коммитится.
+func DeadLetter(producer *broker.Producer, cfg DeadLetterConfig) Middleware {
+	return escalate(producer, RetryConfig{DeadLetter: cfg}, "", 0)
+}
+
+// DeadLetterMessage — сообщение dead-letter топика для просмотра в админке
+type DeadLetterMessage struct {
+	Partition int
+	Offset    int64
+	Key       string
+	Value     []byte
+	Headers   map[string]string
+	Time      time.Time
+}
+
+// ListDeadLetters читает последние limit сообщений dead-letter топика (не больше limit на
+// партицию), новые первыми. Offset'ы групп не меняются.
+func ListDeadLetters(ctx context.Context, brokers, topic string, limit int) ([]*DeadLetterMessage, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*DeadLetterMessage
+	for _, p := range partitions {
+		leader, err := kafka.DialLeader(ctx, "tcp", brokers, topic, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		first, last, err := leader.ReadOffsets()
+		leader.Close()
+		if err != nil {
+			return nil, err
+		}
+		start := max(first, last-int64(limit))
+		if start >= last {
+			continue
+		}
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   []string{brokers},
+			Topic:     topic,
+			Partition: p.ID,
+			MinBytes:  1,
+			MaxBytes:  10e6,
+		})
+		reader.SetOffset(start)
+		for {
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			messages = append(messages, &DeadLetterMessage{
+				Partition: m.Partition,
+				Offset:    m.Offset,
+				Key:       string(m.Key),
+				Value:     m.Value,
+				Headers:   headerMap(m.Headers),
+				Time:      m.Time,
+			})
+			if m.Offset >= last-1 {
+				break
+			}
+		}
+		reader.Close()
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Time.After(messages[j].Time) })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// Redrive возвращает до limit сообщений dead-letter топика в исходные топики (заголовок dlq_topic)
+// без служебных заголовков dlq_*. Прогресс хранится в группе groupID, поэтому повторный вызов
+// продолжает с первого невозвращенного сообщения. Возвращает число переотправленных сообщений.
+func Redrive(ctx context.Context, brokers string, producer *broker.Producer, topic, groupID string, limit int) (int, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{brokers},
+		Topic:       topic,
+		GroupID:     groupID,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		MaxWait:     100 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	redriven := 0
+	for redriven < limit {
+		// Сообщений больше нет, если за таймаут ничего не пришло (с запасом на вход в группу)
+		fetchCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return redriven, err
+		}
+		headers := headerMap(m.Headers)
+		source := headers[HeaderDLQTopic]
+		if source == "" {
+			log.Printf("Skipping %s/%d@%d: no %s header", topic, m.Partition, m.Offset, HeaderDLQTopic)
+		} else {
+			for k := range headers {
+				if strings.HasPrefix(k, "dlq_") {
+					delete(headers, k)
+				}
+			}
+			errs := producer.SendBatch(ctx, []broker.Message{{Topic: source, Key: string(m.Key), Value: m.Value, Headers: headers}})
+			if errs != nil {
+				return redriven, fmt.Errorf("redrive to %s: %w", source, errs[0])
+			}
+			redriven++
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			return redriven, err
+		}
+	}
+	return redriven, nil
+}
+
+func headerMap(headers []kafka.Header) map[string]string {
+	out := make(map[string]string, len(headers))
+	for _, h := range headers {
+		out[h.Key] = string(h.Value)
+	}
+	return out
+}
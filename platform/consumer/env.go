@@ -0,0 +1,59 @@
+package consumer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWorkers — число воркеров консьюмера без CONSUMER_WORKERS
+const DefaultWorkers = 4
+
+// WorkersFromEnv возвращает CONSUMER_WORKERS — число параллельных обработчиков консьюмера
+// (Config.Workers); сообщения одного ключа идут последовательно
+func WorkersFromEnv() (int, error) {
+	v := os.Getenv("CONSUMER_WORKERS")
+	if v == "" {
+		return DefaultWorkers, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad CONSUMER_WORKERS %q", v)
+	}
+	return n, nil
+}
+
+// RetryConfigFromEnv — DefaultRetryConfig(source), переопределенный переменными окружения:
+// topicEnv — dead-letter топик, CONSUMER_RETRY_DELAYS — задержки уровней ("5s,1m,10m",
+// "off" — без уровней), CONSUMER_MAX_ATTEMPTS — попытки на каждом уровне (без уровней — на месте).
+func RetryConfigFromEnv(source, topicEnv string) (RetryConfig, error) {
+	cfg := DefaultRetryConfig(source)
+	if v := os.Getenv(topicEnv); v != "" {
+		cfg.DeadLetter.Topic = v
+	}
+	switch v := os.Getenv("CONSUMER_RETRY_DELAYS"); v {
+	case "":
+	case "off":
+		cfg.Delays = nil
+		cfg.DeadLetter.MaxAttempts = DefaultDeadLetterConfig(source).MaxAttempts
+	default:
+		cfg.Delays = nil
+		for _, s := range strings.Split(v, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil || d <= 0 {
+				return RetryConfig{}, fmt.Errorf("bad CONSUMER_RETRY_DELAYS %q", v)
+			}
+			cfg.Delays = append(cfg.Delays, d)
+		}
+	}
+	if v := os.Getenv("CONSUMER_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return RetryConfig{}, fmt.Errorf("bad CONSUMER_MAX_ATTEMPTS %q", v)
+		}
+		cfg.DeadLetter.MaxAttempts = n
+	}
+	return cfg, nil
+}
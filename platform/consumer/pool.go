@@ -0,0 +1,237 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// queueSize — очередь одного воркера; pendingPerWorker ограничивает число сообщений,
+// прочитанных, но еще не закоммиченных (в том числе обработанных позже зависшего)
+const (
+	queueSize        = 64
+	pendingPerWorker = 256
+)
+
+// startPool читает сообщения и раздает их воркерам по хешу ключа: сообщения одного ключа
+// обрабатываются последовательно, разных — параллельно. Offset партиции коммитится только
+// после обработки всех более ранних сообщений этой партиции. Сообщение с ошибкой, как и в
+// последовательном режиме, повторяется на месте: коммиты партиции и очередь его воркера ждут,
+// а когда заполнится лимит pending, останавливается и чтение.
+func (c *Consumer) startPool(ctx context.Context) {
+	var (
+		tracker = newOffsetTracker(c.workers * pendingPerWorker)
+		queues  = make([]chan *tracked, c.workers)
+		commits = make(chan kafka.Message, c.workers*queueSize)
+		wg      sync.WaitGroup
+	)
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		c.commitLoop(commits)
+	}()
+	for i := range queues {
+		queues[i] = make(chan *tracked, queueSize)
+		wg.Add(1)
+		go func(queue <-chan *tracked) {
+			defer wg.Done()
+			for t := range queue {
+				if ctx.Err() != nil || tracker.abandoned(t) {
+					// Остановка или партиция переназначена: сообщение прочитается снова
+					continue
+				}
+				if !c.handleUntilDone(ctx, t.msg, func() bool { return tracker.abandoned(t) }) {
+					continue
+				}
+				if m, ok := tracker.complete(t); ok {
+					commits <- m
+				}
+			}
+		}(queues[i])
+	}
+
+	// stall — первое необработанное сообщение при прошлом упоре в лимит pending
+	var (
+		stall  = kafka.Message{Partition: -1}
+		logged bool
+	)
+	for {
+		if !tracker.tryReserve() {
+			// Лимит заполняется и при обычной нагрузке, поэтому в лог попадает только сообщение,
+			// которое не продвинулось между двумя упорами подряд
+			if m, n, ok := tracker.stalled(); ok {
+				same := m.Partition == stall.Partition && m.Offset == stall.Offset
+				if same && !logged {
+					log.Printf("%s: %d messages pending, reading paused until partition %d offset %d is processed",
+						c.name, n, m.Partition, m.Offset)
+				}
+				stall, logged = m, same
+			}
+			if !tracker.reserve(ctx) {
+				break
+			}
+		}
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			tracker.release(1)
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("%s: error fetching message: %v", c.name, err)
+			continue
+		}
+		queues[keyHash(c.key(m))%uint32(len(queues))] <- tracker.add(m)
+	}
+
+	log.Printf("Stopping %s...", c.name)
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	close(commits)
+	<-committed
+}
+
+// commitLoop коммитит offset'ы по мере продвижения партиций. Воркеры завершаются в любом
+// порядке, поэтому меньший offset после большего пропускается.
+func (c *Consumer) commitLoop(commits <-chan kafka.Message) {
+	last := map[int]int64{}
+	for m := range commits {
+		if prev, ok := last[m.Partition]; ok && m.Offset <= prev {
+			continue
+		}
+		// ctx консьюмера при остановке уже отменен, а обработанное нужно успеть закоммитить
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.reader.CommitMessages(ctx, m)
+		cancel()
+		if err != nil {
+			log.Printf("%s: failed to commit offset %d: %v", c.name, m.Offset, err)
+			continue
+		}
+		last[m.Partition] = m.Offset
+	}
+}
+
+type tracked struct {
+	msg  kafka.Message
+	done bool
+	// dropped — партиция была переназначена, сообщение будет прочитано заново
+	dropped bool
+}
+
+// offsetTracker хранит прочитанные сообщения каждой партиции в порядке offset'ов
+// и отдает последнее сообщение непрерывного обработанного префикса
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending map[int][]*tracked
+	// slots ограничивает число сообщений в pending
+	slots chan struct{}
+}
+
+func newOffsetTracker(limit int) *offsetTracker {
+	return &offsetTracker{pending: map[int][]*tracked{}, slots: make(chan struct{}, limit)}
+}
+
+// tryReserve занимает место в pending, если оно есть
+func (t *offsetTracker) tryReserve() bool {
+	select {
+	case t.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// reserve ждет свободного места в pending; false — ctx отменен
+func (t *offsetTracker) reserve(ctx context.Context) bool {
+	select {
+	case t.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (t *offsetTracker) release(n int) {
+	for range n {
+		<-t.slots
+	}
+}
+
+// add добавляет прочитанное сообщение. Offset не больше уже ожидающего значит, что партицию
+// отобрали при ребалансировке и вернули с закоммиченного offset'а: ее прежние записи
+// сбрасываются, чтобы не держать место в pending и не коммитить устаревшие offset'ы.
+// Записи партиции, отданной другому инстансу насовсем, остаются до обработки, а их коммиты
+// отклоняет брокер.
+func (t *offsetTracker) add(m kafka.Message) *tracked {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if queue := t.pending[m.Partition]; len(queue) > 0 && m.Offset <= queue[len(queue)-1].msg.Offset {
+		for _, e := range queue {
+			e.dropped = true
+		}
+		delete(t.pending, m.Partition)
+		t.release(len(queue))
+	}
+	e := &tracked{msg: m}
+	t.pending[m.Partition] = append(t.pending[m.Partition], e)
+	return e
+}
+
+// complete отмечает сообщение обработанным. ok — префикс партиции продвинулся,
+// и возвращенное сообщение можно коммитить.
+func (t *offsetTracker) complete(e *tracked) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e.dropped {
+		return kafka.Message{}, false
+	}
+	e.done = true
+	queue := t.pending[e.msg.Partition]
+	n := 0
+	for n < len(queue) && queue[n].done {
+		n++
+	}
+	if n == 0 {
+		return kafka.Message{}, false
+	}
+	last := queue[n-1].msg
+	t.pending[e.msg.Partition] = queue[n:]
+	t.release(n)
+	return last, true
+}
+
+// abandoned сообщает, что запись сброшена ребалансировкой и обрабатывать ее не нужно
+func (t *offsetTracker) abandoned(e *tracked) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return e.dropped
+}
+
+// stalled возвращает сообщение, которое держит больше всего записей pending (первое
+// необработанное в самой длинной очереди партиции), и размер этой очереди
+func (t *offsetTracker) stalled() (kafka.Message, int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var head *tracked
+	n := 0
+	for _, queue := range t.pending {
+		if len(queue) > n {
+			head, n = queue[0], len(queue)
+		}
+	}
+	if head == nil {
+		return kafka.Message{}, 0, false
+	}
+	return head.msg, n, true
+}
+
+func keyHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
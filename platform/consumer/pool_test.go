@@ -0,0 +1,309 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTrackerComplete(t *testing.T) {
+	type step struct {
+		partition int
+		offset    int64
+		// wantOffset — закоммиченный offset после шага, -1 — коммита нет
+		wantOffset int64
+	}
+	tests := []struct {
+		name  string
+		added map[int][]int64
+		steps []step
+	}{
+		{
+			name:  "in order",
+			added: map[int][]int64{0: {0, 1, 2}},
+			steps: []step{{0, 0, 0}, {0, 1, 1}, {0, 2, 2}},
+		},
+		{
+			name:  "out of order waits for the gap",
+			added: map[int][]int64{0: {0, 1, 2, 3}},
+			steps: []step{{0, 2, -1}, {0, 3, -1}, {0, 1, -1}, {0, 0, 3}},
+		},
+		{
+			name:  "gap in the middle",
+			added: map[int][]int64{0: {10, 11, 12}},
+			steps: []step{{0, 10, 10}, {0, 12, -1}, {0, 11, 12}},
+		},
+		{
+			name:  "partitions are independent",
+			added: map[int][]int64{0: {0, 1}, 1: {5, 6}},
+			steps: []step{{1, 6, -1}, {0, 0, 0}, {1, 5, 6}, {0, 1, 1}},
+		},
+		{
+			name:  "unfinished message blocks only its partition",
+			added: map[int][]int64{0: {0, 1}, 1: {0, 1}},
+			steps: []step{{0, 1, -1}, {1, 0, 0}, {1, 1, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker(100)
+			entries := map[int]map[int64]*tracked{}
+			for partition, offsets := range tt.added {
+				entries[partition] = map[int64]*tracked{}
+				for _, offset := range offsets {
+					if !tracker.reserve(context.Background()) {
+						t.Fatal("reserve failed")
+					}
+					entries[partition][offset] = tracker.add(kafka.Message{Partition: partition, Offset: offset})
+				}
+			}
+			for _, s := range tt.steps {
+				m, ok := tracker.complete(entries[s.partition][s.offset])
+				switch {
+				case s.wantOffset < 0 && ok:
+					t.Fatalf("complete(%d@%d) committed %d, want nothing", s.partition, s.offset, m.Offset)
+				case s.wantOffset >= 0 && !ok:
+					t.Fatalf("complete(%d@%d) committed nothing, want %d", s.partition, s.offset, s.wantOffset)
+				case ok && (m.Partition != s.partition || m.Offset != s.wantOffset):
+					t.Fatalf("complete(%d@%d) committed %d@%d, want %d@%d",
+						s.partition, s.offset, m.Partition, m.Offset, s.partition, s.wantOffset)
+				}
+			}
+		})
+	}
+}
+
+// fakeReader отдает заданные сообщения, а затем ждет отмены ctx, как kafka.Reader без новых данных
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	next      int
+	committed []kafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.next < len(r.msgs) {
+		m := r.msgs[r.next]
+		r.next++
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+// lastCommitted — наибольший закоммиченный offset партиции, -1 — коммитов не было
+func (r *fakeReader) lastCommitted(partition int) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := int64(-1)
+	for _, m := range r.committed {
+		if m.Partition == partition {
+			last = max(last, m.Offset)
+		}
+	}
+	return last
+}
+
+func messages(partition int, keys ...string) []kafka.Message {
+	msgs := make([]kafka.Message, len(keys))
+	for i, key := range keys {
+		msgs[i] = kafka.Message{Partition: partition, Offset: int64(i), Key: []byte(key)}
+	}
+	return msgs
+}
+
+func newTestConsumer(r *fakeReader, handler Handler) *Consumer {
+	return &Consumer{
+		name:    "test",
+		reader:  r,
+		handler: handler,
+		workers: 4,
+		key:     func(m kafka.Message) string { return string(m.Key) },
+		backoff: time.Millisecond,
+	}
+}
+
+// runPool запускает startPool и возвращает функцию остановки, дожидающуюся выхода
+func runPool(c *Consumer) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.startPool(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolSameKeySerialAndCommitsInOrder(t *testing.T) {
+	r := &fakeReader{msgs: messages(0, "a", "b", "a", "b", "a", "b", "a", "b")}
+	var (
+		mu       sync.Mutex
+		inFlight = map[string]int{}
+		seen     = map[string][]int64{}
+	)
+	gate := make(chan struct{})
+	c := newTestConsumer(r, func(ctx context.Context, m kafka.Message) error {
+		key := string(m.Key)
+		mu.Lock()
+		inFlight[key]++
+		if inFlight[key] > 1 {
+			t.Errorf("key %s handled concurrently at offset %d", key, m.Offset)
+		}
+		seen[key] = append(seen[key], m.Offset)
+		mu.Unlock()
+		// Первое сообщение ключа b зависает, пока тест его не отпустит
+		if m.Offset == 1 {
+			<-gate
+		}
+		mu.Lock()
+		inFlight[key]--
+		mu.Unlock()
+		return nil
+	})
+	stop := runPool(c)
+	defer stop()
+
+	// Ключ a обрабатывается дальше, но offset не проходит зависшее сообщение 1
+	waitFor(t, "key a to finish", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen["a"]) == 4
+	})
+	if last := r.lastCommitted(0); last > 0 {
+		t.Fatalf("committed offset %d past unfinished offset 1", last)
+	}
+
+	close(gate)
+	waitFor(t, "all offsets committed", func() bool { return r.lastCommitted(0) == 7 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for key, offsets := range seen {
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("key %s handled out of order: %v", key, offsets)
+			}
+		}
+	}
+}
+
+func TestPoolRetriesFailedMessageInPlace(t *testing.T) {
+	r := &fakeReader{msgs: messages(0, "a", "b", "c", "d")}
+	var (
+		healed   atomic.Bool
+		failures atomic.Int32
+		handled  atomic.Int32
+	)
+	c := newTestConsumer(r, func(ctx context.Context, m kafka.Message) error {
+		if m.Offset == 1 && !healed.Load() {
+			failures.Add(1)
+			return errors.New("boom")
+		}
+		handled.Add(1)
+		return nil
+	})
+	stop := runPool(c)
+	defer stop()
+
+	// Другие ключи обрабатываются, но offset не проходит падающее сообщение 1
+	waitFor(t, "other messages handled", func() bool { return handled.Load() == 3 && failures.Load() >= 3 })
+	if last := r.lastCommitted(0); last != 0 {
+		t.Fatalf("last committed offset %d while offset 1 fails, want 0", last)
+	}
+
+	healed.Store(true)
+	waitFor(t, "all offsets committed", func() bool { return r.lastCommitted(0) == 3 })
+}
+
+func TestOffsetTrackerRewindDropsStaleEntries(t *testing.T) {
+	tracker := newOffsetTracker(10)
+	add := func(partition int, offset int64) *tracked {
+		if !tracker.reserve(context.Background()) {
+			t.Fatal("reserve failed")
+		}
+		return tracker.add(kafka.Message{Partition: partition, Offset: offset})
+	}
+	stale := []*tracked{add(0, 5), add(0, 6)}
+	other := add(1, 0)
+
+	// Партиция 0 вернулась после ребалансировки с закоммиченного offset'а 5
+	fresh := add(0, 5)
+	for _, e := range stale {
+		if !tracker.abandoned(e) {
+			t.Fatalf("entry %d not abandoned after rewind", e.msg.Offset)
+		}
+		if _, ok := tracker.complete(e); ok {
+			t.Fatalf("complete of stale entry %d committed", e.msg.Offset)
+		}
+	}
+	if n := len(tracker.slots); n != 2 {
+		t.Fatalf("%d slots in use after rewind, want 2", n)
+	}
+	if m, ok := tracker.complete(fresh); !ok || m.Offset != 5 {
+		t.Fatalf("complete(fresh) = %d, %v, want 5, true", m.Offset, ok)
+	}
+	if tracker.abandoned(other) {
+		t.Fatal("entry of another partition abandoned")
+	}
+}
+
+func TestPoolStopDoesNotCommitInterruptedMessage(t *testing.T) {
+	r := &fakeReader{msgs: messages(0, "a", "b", "b")}
+	started := make(chan struct{})
+	var handledAfterStop atomic.Bool
+	c := newTestConsumer(r, func(ctx context.Context, m kafka.Message) error {
+		if m.Offset == 2 {
+			handledAfterStop.Store(true)
+		}
+		if m.Offset == 1 {
+			// Обработка прерывается остановкой консьюмера
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	stop := runPool(c)
+	<-started
+	waitFor(t, "offset 0 committed", func() bool { return r.lastCommitted(0) == 0 })
+	stop()
+
+	// Сообщение 2 стояло в очереди за прерванным и не должно быть ни обработано, ни закоммичено
+	if handledAfterStop.Load() {
+		t.Fatal("message queued behind the interrupted one was handled after stop")
+	}
+	if last := r.lastCommitted(0); last != 0 {
+		t.Fatalf("last committed offset %d after stop, want 0", last)
+	}
+}
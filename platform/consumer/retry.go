@@ -0,0 +1,220 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gozon/platform/broker"
+	"gozon/platform/events"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку как постоянную: повтор ее не исправит (нет заказа, битые данные),
+// поэтому сообщение сразу уходит в dead-letter, минуя уровни повтора
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent — ошибка помечена Permanent или вызвана несовместимой схемой события.
+// Остальные ошибки (БД, сеть) считаются временными.
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe) || events.IsSchemaError(err)
+}
+
+type RetryConfig struct {
+	// Delays — задержки уровней повтора. Уровень i читает топик <topic>.retry.<Delays[i]>
+	// и обрабатывает сообщение не раньше, чем через Delays[i] после публикации.
+	Delays     []time.Duration
+	DeadLetter DeadLetterConfig
+	// Партиции и репликация топиков повтора и dead-letter, создаваемых при старте
+	TopicPartitions        int
+	TopicReplicationFactor int
+}
+
+// DefaultRetryConfig — уровни 5s, 1m, 10m по одной попытке и dead-letter <sourceTopic>.dlq.
+// Повторы на месте задерживают партицию, поэтому при уровнях по умолчанию их нет.
+func DefaultRetryConfig(sourceTopic string) RetryConfig {
+	deadLetter := DefaultDeadLetterConfig(sourceTopic)
+	deadLetter.MaxAttempts = 1
+	return RetryConfig{
+		Delays:                 []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute},
+		DeadLetter:             deadLetter,
+		TopicPartitions:        3,
+		TopicReplicationFactor: 1,
+	}
+}
+
+// RetryTopic возвращает имя топика уровня повтора: orders.created.retry.5s, .1m, .10m
+func RetryTopic(sourceTopic string, delay time.Duration) string {
+	return sourceTopic + ".retry." + delayName(delay)
+}
+
+// delayName — короткая запись задержки: 1m вместо 1m0s
+func delayName(delay time.Duration) string {
+	switch {
+	case delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	}
+	return delay.String()
+}
+
+// Group — консьюмер топика вместе с консьюмерами его уровней повтора
+type Group struct {
+	producer *broker.Producer
+	topics   []string
+	cfg      RetryConfig
+	members  []*Consumer
+}
+
+// NewWithRetries собирает консьюмер cfg.Topic и по консьюмеру на каждый уровень повтора.
+// Временная ошибка переносит сообщение на следующий уровень, постоянная или ошибка последнего
+// уровня — в dead-letter. Offset исходного сообщения коммитится сразу, поэтому медленный
+// повтор не задерживает партицию. middlewares оборачивают handler на каждом уровне.
+func NewWithRetries(cfg Config, producer *broker.Producer, retry RetryConfig, handler Handler, middlewares ...Middleware) *Group {
+	g := &Group{producer: producer, cfg: retry, topics: []string{retry.DeadLetter.Topic}}
+	g.members = append(g.members, New(cfg, handler,
+		append([]Middleware{escalate(producer, retry, cfg.Topic, 0)}, middlewares...)...))
+	for i, delay := range retry.Delays {
+		levelCfg := cfg
+		levelCfg.Name = fmt.Sprintf("%s (retry %s)", cfg.Name, delay)
+		levelCfg.Topic = RetryTopic(cfg.Topic, delay)
+		levelCfg.GroupID = cfg.GroupID + ".retry." + delayName(delay)
+		g.topics = append(g.topics, levelCfg.Topic)
+		g.members = append(g.members, New(levelCfg, handler,
+			append([]Middleware{delayed(delay), escalate(producer, retry, cfg.Topic, i+1)}, middlewares...)...))
+	}
+	return g
+}
+
+// Start создает топики повтора и dead-letter и читает все уровни до отмены ctx
+func (g *Group) Start(ctx context.Context) {
+	if err := g.producer.EnsureTopics(g.cfg.TopicPartitions, g.cfg.TopicReplicationFactor, g.topics...); err != nil {
+		log.Printf("Failed to create retry topics %v: %v", g.topics, err)
+	}
+	var wg sync.WaitGroup
+	for _, c := range g.members {
+		wg.Add(1)
+		go func(c *Consumer) {
+			defer wg.Done()
+			c.Start(ctx)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// delayed откладывает обработку до времени публикации сообщения + delay. В топике уровня
+// задержка одинакова, поэтому ожидание первого сообщения не задерживает следующие дольше нужного.
+func delayed(delay time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m kafka.Message) error {
+			if wait := time.Until(m.Time.Add(delay)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+			return next(ctx, m)
+		}
+	}
+}
+
+// escalate обрабатывает сообщение уровня level (до DeadLetter.MaxAttempts попыток на месте),
+// а при неудаче публикует его на следующий уровень или в dead-letter и считает обработанным. Offset коммитится только после
+// успешной публикации: пока Kafka недоступна, публикация повторяется, и партиция стоит.
+func escalate(producer *broker.Producer, cfg RetryConfig, sourceTopic string, level int) Middleware {
+	maxAttempts := max(cfg.DeadLetter.MaxAttempts, 1)
+	permanent := cfg.DeadLetter.Permanent
+	if permanent == nil {
+		permanent = IsPermanent
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m kafka.Message) error {
+			var (
+				err      error
+				attempts int
+			)
+			for attempts = 1; ; attempts++ {
+				if err = next(ctx, m); err == nil {
+					return nil
+				}
+				if attempts >= maxAttempts || permanent(err) {
+					break
+				}
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(cfg.DeadLetter.Backoff * time.Duration(attempts)):
+				}
+			}
+			if ctx.Err() != nil {
+				// Остановка сервиса, а не ошибка сообщения
+				return err
+			}
+
+			dest := cfg.DeadLetter.Topic
+			if level < len(cfg.Delays) && !permanent(err) {
+				dest = RetryTopic(sourceTopic, cfg.Delays[level])
+			}
+			headers := headerMap(m.Headers)
+			if _, ok := headers[HeaderDLQTopic]; !ok {
+				// Первая неудача: запоминаем координаты исходного сообщения
+				headers[HeaderDLQTopic] = m.Topic
+				headers[HeaderDLQPartition] = strconv.Itoa(m.Partition)
+				headers[HeaderDLQOffset] = strconv.FormatInt(m.Offset, 10)
+			}
+			prev, _ := strconv.Atoi(headers[HeaderDLQAttempts])
+			headers[HeaderDLQAttempts] = strconv.Itoa(prev + attempts)
+			headers[HeaderDLQError] = err.Error()
+			headers[HeaderDLQFailedAt] = time.Now().UTC().Format(time.RFC3339)
+			if perr := publishBlocking(ctx, producer, broker.Message{Topic: dest, Key: string(m.Key), Value: m.Value, Headers: headers}, cfg.DeadLetter.Backoff); perr != nil {
+				// Остановка сервиса: offset не коммитится, сообщение будет прочитано снова
+				return fmt.Errorf("%w (publish to %s interrupted: %v)", err, dest, perr)
+			}
+			log.Printf("Message %s/%d@%d moved to %s after %d attempts: %v", m.Topic, m.Partition, m.Offset, dest, prev+attempts, err)
+			return nil
+		}
+	}
+}
+
+// maxPublishBackoff — наибольшая пауза между попытками публикации в retry- или dead-letter топик
+const maxPublishBackoff = 30 * time.Second
+
+// publishBlocking публикует сообщение, повторяя попытки с растущей паузой (до maxPublishBackoff),
+// пока публикация не удастся. Ошибка возвращается только при отмене ctx.
+func publishBlocking(ctx context.Context, producer *broker.Producer, msg broker.Message, backoff time.Duration) error {
+	backoff = max(backoff, 100*time.Millisecond)
+	for {
+		errs := producer.SendBatch(ctx, []broker.Message{msg})
+		if errs == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Failed to publish to %s, retrying in %s: %v", msg.Topic, backoff, errs[0])
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxPublishBackoff)
+	}
+}
@@ -0,0 +1,7 @@
+// Package contracts — контракты событий между сервисами: доменные структуры данных событий
+// (OrderCreatedEvent, PaymentStatusEvent, BalanceChangedEvent) и их Protobuf-схемы для формата
+// application/protobuf. Доменные структуры конвертируются в сгенерированные типы в методах
+// MarshalProto/UnmarshalProto.
+package contracts
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative events.proto
@@ -0,0 +1,121 @@
+package contracts
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+// OrderCreatedEvent — данные события gozon.order.created
+type OrderCreatedEvent struct {
+	OrderID uuid.UUID `json:"order_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Amount  int64     `json:"amount"`
+}
+
+// MarshalProto кодирует событие по схеме OrderCreated
+func (e OrderCreatedEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&OrderCreated{
+		OrderId: e.OrderID.String(),
+		UserId:  e.UserID.String(),
+		Amount:  e.Amount,
+	})
+}
+
+// UnmarshalProto разбирает событие по схеме OrderCreated
+func (e *OrderCreatedEvent) UnmarshalProto(data []byte) error {
+	var msg OrderCreated
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	orderID, err := uuid.Parse(msg.OrderId)
+	if err != nil {
+		return fmt.Errorf("bad order_id: %w", err)
+	}
+	userID, err := uuid.Parse(msg.UserId)
+	if err != nil {
+		return fmt.Errorf("bad user_id: %w", err)
+	}
+	*e = OrderCreatedEvent{OrderID: orderID, UserID: userID, Amount: msg.Amount}
+	return nil
+}
+
+// Validate отсекает события, по которым нельзя списывать: без заказа, пользователя или суммы
+func (e *OrderCreatedEvent) Validate() error {
+	switch {
+	case e.OrderID == uuid.Nil:
+		return fmt.Errorf("order_id is required")
+	case e.UserID == uuid.Nil:
+		return fmt.Errorf("user_id is required")
+	case e.Amount <= 0:
+		return fmt.Errorf("amount must be positive, got %d", e.Amount)
+	}
+	return nil
+}
+
+// Итоговые статусы оплаты в событии gozon.payment.processed
+const (
+	PaymentFinished  = "FINISHED"
+	PaymentCancelled = "CANCELLED"
+)
+
+// PaymentStatusEvent — данные события gozon.payment.processed
+type PaymentStatusEvent struct {
+	OrderID uuid.UUID `json:"order_id"`
+	Status  string    `json:"status"`
+}
+
+// MarshalProto кодирует событие по схеме PaymentStatus
+func (e PaymentStatusEvent) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&PaymentStatus{OrderId: e.OrderID.String(), Status: e.Status})
+}
+
+// UnmarshalProto разбирает событие по схеме PaymentStatus
+func (e *PaymentStatusEvent) UnmarshalProto(data []byte) error {
+	var msg PaymentStatus
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	orderID, err := uuid.Parse(msg.OrderId)
+	if err != nil {
+		return fmt.Errorf("bad order_id: %w", err)
+	}
+	*e = PaymentStatusEvent{OrderID: orderID, Status: msg.Status}
+	return nil
+}
+
+// Validate отсекает события без заказа или с неизвестным статусом
+func (e *PaymentStatusEvent) Validate() error {
+	if e.OrderID == uuid.Nil {
+		return fmt.Errorf("order_id is required")
+	}
+	if e.Status != PaymentFinished && e.Status != PaymentCancelled {
+		return fmt.Errorf("unknown status %q", e.Status)
+	}
+	return nil
+}
+
+// Причины изменения баланса в событии gozon.balance.changed
+const (
+	BalanceReasonDeposit      = "DEPOSIT"
+	BalanceReasonOrderPayment = "ORDER_PAYMENT"
+)
+
+// BalanceChangedEvent — данные события gozon.balance.changed. Схемы Protobuf у события нет,
+// оно публикуется только в JSON.
+type BalanceChangedEvent struct {
+	UserID  uuid.UUID  `json:"user_id"`
+	Balance int64      `json:"balance"`
+	Delta   int64      `json:"delta"`
+	Reason  string     `json:"reason"`
+	OrderID *uuid.UUID `json:"order_id,omitempty"`
+}
+
+// Validate отсекает события без пользователя: их некому доставить
+func (e *BalanceChangedEvent) Validate() error {
+	if e.UserID == uuid.Nil {
+		return fmt.Errorf("user_id is required")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package events — конверт доменных событий в формате CloudEvents 1.0. В Kafka используется
+// binary content mode: атрибуты передаются заголовками ce_*, значение сообщения — данные события.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	SpecVersion         = "1.0"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// Заголовки Kafka по CloudEvents Kafka Protocol Binding. Расширения: causationid — ID события,
+// в ответ на которое опубликовано это, dataversion — версия схемы данных.
+const (
+	HeaderSpecVersion = "ce_specversion"
+	HeaderID          = "ce_id"
+	HeaderSource      = "ce_source"
+	HeaderType        = "ce_type"
+	HeaderSubject     = "ce_subject"
+	HeaderTime        = "ce_time"
+	HeaderCausationID = "ce_causationid"
+	HeaderDataVersion = "ce_dataversion"
+	HeaderContentType = "content-type"
+)
+
+type Event struct {
+	ID     string
+	Source string
+	Type   string
+	// Subject — ID агрегата, к которому относится событие
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	// DataVersion — версия схемы данных, 0 у сообщений без заголовка (считается первой)
+	DataVersion int
+	CausationID string
+	Data        []byte
+}
+
+// New собирает событие с новым ID и JSON-данными
+func New(source, eventType, subject string, data any) (Event, error) {
+	return NewAs(FormatJSON, source, eventType, subject, data)
+}
+
+// NewAs собирает событие с данными в формате format. Версия схемы берется из Versioned, иначе 1.
+func NewAs(format Format, source, eventType, subject string, data any) (Event, error) {
+	contentType, body, err := encode(format, data)
+	if err != nil {
+		return Event{}, fmt.Errorf("marshal %s: %w", eventType, err)
+	}
+	version := 1
+	if v, ok := data.(Versioned); ok {
+		version = v.SchemaVersion()
+	}
+	return Event{
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentType,
+		DataVersion:     version,
+		Data:            body,
+	}, nil
+}
+
+// CausedBy отмечает событие как следствие cause
+func (e Event) CausedBy(cause Event) Event {
+	e.CausationID = cause.ID
+	return e
+}
+
+// Headers возвращает атрибуты события заголовками Kafka. Пустые необязательные атрибуты опускаются.
+func (e Event) Headers() map[string]string {
+	h := map[string]string{
+		HeaderSpecVersion: SpecVersion,
+		HeaderID:          e.ID,
+		HeaderSource:      e.Source,
+		HeaderType:        e.Type,
+		HeaderTime:        e.Time.Format(time.RFC3339Nano),
+	}
+	if e.Subject != "" {
+		h[HeaderSubject] = e.Subject
+	}
+	if e.CausationID != "" {
+		h[HeaderCausationID] = e.CausationID
+	}
+	if e.DataVersion > 0 {
+		h[HeaderDataVersion] = strconv.Itoa(e.DataVersion)
+	}
+	if e.DataContentType != "" {
+		h[HeaderContentType] = e.DataContentType
+	}
+	return h
+}
+
+// FromKafka восстанавливает событие из сообщения. У сообщения без заголовков ce_*
+// (записано до перехода на конверт) Type пустой, а Data — значение как есть.
+func FromKafka(m kafka.Message) Event {
+	e := Event{Data: m.Value}
+	for _, h := range m.Headers {
+		v := string(h.Value)
+		switch h.Key {
+		case HeaderID:
+			e.ID = v
+		case HeaderSource:
+			e.Source = v
+		case HeaderType:
+			e.Type = v
+		case HeaderSubject:
+			e.Subject = v
+		case HeaderTime:
+			e.Time, _ = time.Parse(time.RFC3339Nano, v)
+		case HeaderCausationID:
+			e.CausationID = v
+		case HeaderDataVersion:
+			e.DataVersion, _ = strconv.Atoi(v)
+		case HeaderContentType:
+			e.DataContentType = v
+		}
+	}
+	return e
+}
+
+// Type возвращает тип события из заголовка ce_type без разбора остальных атрибутов
+func Type(m kafka.Message) string {
+	for _, h := range m.Headers {
+		if h.Key == HeaderType {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Decode разбирает данные события в v по заголовку content-type. Пустой content-type — JSON.
+func (e Event) Decode(v any) error {
+	switch e.DataContentType {
+	case "", ContentTypeJSON:
+		return json.Unmarshal(e.Data, v)
+	case ContentTypeProtobuf:
+		pm, ok := v.(ProtoUnmarshaler)
+		if !ok {
+			return fmt.Errorf("%T has no protobuf mapping", v)
+		}
+		return pm.UnmarshalProto(e.Data)
+	default:
+		return fmt.Errorf("unsupported content type %q", e.DataContentType)
+	}
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestHeadersRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{
+			name: "all attributes",
+			event: Event{
+				ID:              "id-1",
+				Source:          "/gozon/orders",
+				Type:            "gozon.order.created",
+				Subject:         "order-1",
+				Time:            time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC),
+				DataContentType: ContentTypeProtobuf,
+				DataVersion:     2,
+				CausationID:     "id-0",
+				Data:            []byte{0x0a, 0x01, 0x61},
+			},
+		},
+		{
+			name: "optional attributes omitted",
+			event: Event{
+				ID:              "id-2",
+				Source:          "/gozon/payments",
+				Type:            "gozon.payment.processed",
+				Time:            time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+				DataContentType: ContentTypeJSON,
+				DataVersion:     1,
+				Data:            []byte(`{"order_id":"1"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := kafka.Message{Value: tt.event.Data}
+			for k, v := range tt.event.Headers() {
+				m.Headers = append(m.Headers, kafka.Header{Key: k, Value: []byte(v)})
+			}
+			got := FromKafka(m)
+			if !reflect.DeepEqual(got, tt.event) {
+				t.Fatalf("FromKafka(Headers()) = %+v, want %+v", got, tt.event)
+			}
+			if Type(m) != tt.event.Type {
+				t.Fatalf("Type = %q, want %q", Type(m), tt.event.Type)
+			}
+		})
+	}
+}
+
+func TestFromKafkaWithoutEnvelope(t *testing.T) {
+	got := FromKafka(kafka.Message{Value: []byte(`{"a":1}`)})
+	if got.Type != "" || got.DataVersion != 0 || string(got.Data) != `{"a":1}` {
+		t.Fatalf("FromKafka of a bare message = %+v", got)
+	}
+}
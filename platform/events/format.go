@@ -0,0 +1,86 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Format — формат данных события в сообщении Kafka
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+)
+
+// ProtoMarshaler реализуют структуры событий, которые публикуются в формате protobuf
+// (схемы в gozon/platform/contracts)
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// ProtoUnmarshaler реализуют структуры событий, которые читаются из формата protobuf
+type ProtoUnmarshaler interface {
+	UnmarshalProto([]byte) error
+}
+
+// Formats — формат по топику. Топики без записи пишутся в JSON.
+type Formats map[string]Format
+
+// For возвращает формат топика
+func (f Formats) For(topic string) Format {
+	if format, ok := f[topic]; ok {
+		return format
+	}
+	return FormatJSON
+}
+
+// ParseFormats разбирает настройку вида "orders.created=protobuf,payments.processed=json"
+func ParseFormats(s string) (Formats, error) {
+	formats := Formats{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		topic, format, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad event format %q, want topic=format", item)
+		}
+		switch Format(format) {
+		case FormatJSON, FormatProtobuf:
+			formats[topic] = Format(format)
+		default:
+			return nil, fmt.Errorf("unknown event format %q for topic %s", format, topic)
+		}
+	}
+	return formats, nil
+}
+
+func encode(format Format, data any) (string, []byte, error) {
+	switch format {
+	case FormatJSON:
+		body, err := json.Marshal(data)
+		return ContentTypeJSON, body, err
+	case FormatProtobuf:
+		pm, ok := data.(ProtoMarshaler)
+		if !ok {
+			return "", nil, fmt.Errorf("%T has no protobuf mapping", data)
+		}
+		body, err := pm.MarshalProto()
+		return ContentTypeProtobuf, body, err
+	default:
+		return "", nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
+
+// FormatsFromEnv разбирает EVENT_FORMATS (см. ParseFormats); без переменной все топики в JSON
+func FormatsFromEnv() (Formats, error) {
+	formats, err := ParseFormats(os.Getenv("EVENT_FORMATS"))
+	if err != nil {
+		return nil, fmt.Errorf("bad EVENT_FORMATS: %w", err)
+	}
+	return formats, nil
+}
@@ -0,0 +1,52 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Formats
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: Formats{}},
+		{name: "one topic", in: "orders.created=protobuf", want: Formats{"orders.created": FormatProtobuf}},
+		{
+			name: "several topics with spaces",
+			in:   " orders.created=protobuf , payments.processed=json,",
+			want: Formats{"orders.created": FormatProtobuf, "payments.processed": FormatJSON},
+		},
+		{name: "missing format", in: "orders.created", wantErr: true},
+		{name: "unknown format", in: "orders.created=avro", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormats(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseFormats(%q) = %v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ParseFormats(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatsForDefaultsToJSON(t *testing.T) {
+	formats := Formats{"orders.created": FormatProtobuf}
+	if got := formats.For("orders.created"); got != FormatProtobuf {
+		t.Errorf("For(orders.created) = %s, want protobuf", got)
+	}
+	if got := formats.For("payments.processed"); got != FormatJSON {
+		t.Errorf("For(payments.processed) = %s, want json", got)
+	}
+}
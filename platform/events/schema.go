@@ -0,0 +1,112 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrSchema — данные события нельзя привести к текущей схеме: неизвестная или более новая
+// версия, отсутствующий upcaster, битые данные или невалидные поля. Такие события не
+// обрабатываются, а уходят в dead-letter.
+var ErrSchema = errors.New("unsupported event schema")
+
+// Versioned реализуют данные событий, у которых версия схемы больше первой
+type Versioned interface {
+	SchemaVersion() int
+}
+
+// Validator проверяет обязательные поля после разбора: json.Unmarshal молча оставляет
+// нулевые значения вместо отсутствующих полей
+type Validator interface {
+	Validate() error
+}
+
+// Upcaster переводит JSON-данные события из версии v в v+1
+type Upcaster func(data map[string]any) (map[string]any, error)
+
+type schema struct {
+	version   int
+	upcasters map[int]Upcaster
+}
+
+// Registry хранит текущие версии схем по типам событий и upcaster'ы старых версий
+type Registry struct {
+	schemas map[string]schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: map[string]schema{}}
+}
+
+// Register задает текущую версию типа события. upcasters[v] переводит данные версии v в v+1.
+func (r *Registry) Register(eventType string, version int, upcasters map[int]Upcaster) *Registry {
+	r.schemas[eventType] = schema{version: version, upcasters: upcasters}
+	return r
+}
+
+// Decode разбирает данные события типа eventType в v, при необходимости поднимая их версию.
+// Тип передается явно: у сообщений без конверта заголовка ce_type нет. Все ошибки схемы
+// оборачивают ErrSchema.
+func (r *Registry) Decode(eventType string, e Event, v any) error {
+	s, ok := r.schemas[eventType]
+	if !ok {
+		return fmt.Errorf("%w: type %q is not registered", ErrSchema, eventType)
+	}
+	version := e.DataVersion
+	if version == 0 {
+		version = 1
+	}
+	if version > s.version {
+		return fmt.Errorf("%w: %s version %d is newer than supported %d", ErrSchema, eventType, version, s.version)
+	}
+	if version < s.version {
+		upcasted, err := s.upcast(e, version)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSchema, eventType, err)
+		}
+		e = upcasted
+	}
+	if err := e.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSchema, eventType, err)
+	}
+	if val, ok := v.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSchema, eventType, err)
+		}
+	}
+	return nil
+}
+
+// upcast применяет upcaster'ы по цепочке от version до текущей версии. Поднимаются только
+// JSON-данные: Protobuf-схемы развиваются совместимо через номера полей.
+func (s schema) upcast(e Event, version int) (Event, error) {
+	if e.DataContentType != "" && e.DataContentType != ContentTypeJSON {
+		return e, fmt.Errorf("cannot upcast %s data from version %d", e.DataContentType, version)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return e, err
+	}
+	for v := version; v < s.version; v++ {
+		up, ok := s.upcasters[v]
+		if !ok {
+			return e, fmt.Errorf("no upcaster from version %d", v)
+		}
+		var err error
+		if data, err = up(data); err != nil {
+			return e, fmt.Errorf("upcast from version %d: %w", v, err)
+		}
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return e, err
+	}
+	e.Data, e.DataVersion = body, s.version
+	return e, nil
+}
+
+// IsSchemaError сообщает, что ошибка вызвана несовместимой схемой события
+func IsSchemaError(err error) bool {
+	return errors.Is(err, ErrSchema)
+}
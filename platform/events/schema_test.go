@@ -0,0 +1,107 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+// itemV2 — данные тестового события второй версии: во v1 поле называлось qty
+type itemV2 struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+func (i *itemV2) Validate() error {
+	if i.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func testRegistry() *Registry {
+	return NewRegistry().Register("item", 2, map[int]Upcaster{
+		1: func(data map[string]any) (map[string]any, error) {
+			data["quantity"] = data["qty"]
+			delete(data, "qty")
+			return data, nil
+		},
+	})
+}
+
+func TestRegistryDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		event     Event
+		want      itemV2
+		// wantErr — ошибка должна оборачивать ErrSchema
+		wantErr bool
+	}{
+		{
+			name:      "current version",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeJSON, DataVersion: 2, Data: []byte(`{"name":"a","quantity":3}`)},
+			want:      itemV2{Name: "a", Quantity: 3},
+		},
+		{
+			name:      "v1 upcast to v2",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeJSON, DataVersion: 1, Data: []byte(`{"name":"a","qty":3}`)},
+			want:      itemV2{Name: "a", Quantity: 3},
+		},
+		{
+			name:      "no version header is v1",
+			eventType: "item",
+			event:     Event{Data: []byte(`{"name":"a","qty":3}`)},
+			want:      itemV2{Name: "a", Quantity: 3},
+		},
+		{
+			name:      "newer version",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeJSON, DataVersion: 3, Data: []byte(`{"name":"a"}`)},
+			wantErr:   true,
+		},
+		{
+			name:      "unknown type",
+			eventType: "other",
+			event:     Event{DataContentType: ContentTypeJSON, Data: []byte(`{"name":"a"}`)},
+			wantErr:   true,
+		},
+		{
+			name:      "protobuf cannot be upcast",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeProtobuf, DataVersion: 1, Data: []byte{0x0a, 0x01, 0x61}},
+			wantErr:   true,
+		},
+		{
+			name:      "validation failure",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeJSON, DataVersion: 2, Data: []byte(`{"quantity":3}`)},
+			wantErr:   true,
+		},
+		{
+			name:      "broken data",
+			eventType: "item",
+			event:     Event{DataContentType: ContentTypeJSON, DataVersion: 2, Data: []byte(`{`)},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got itemV2
+			err := testRegistry().Decode(tt.eventType, tt.event, &got)
+			if tt.wantErr {
+				if !IsSchemaError(err) {
+					t.Fatalf("err = %v, want schema error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
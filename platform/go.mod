@@ -0,0 +1,22 @@
+module gozon/platform
+
+go 1.25.0
+
+require (
+	github.com/google/uuid v1.6.0
+	github.com/jackc/pglogrepl v0.0.0-20250331215543-51ad596ee12f
+	github.com/jackc/pgx/v5 v5.7.1
+	github.com/lib/pq v1.10.9
+	github.com/segmentio/kafka-go v0.4.49
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/jackc/pgio v1.0.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
@@ -0,0 +1,75 @@
+// Package inbox реализует inbox pattern: ID обработанного сообщения сохраняется в той же
+// транзакции, что и результат обработки, поэтому повтор из Kafka не применяется дважды.
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"gozon/platform/consumer"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// Schema — DDL таблицы inbox, сервисы включают его в свой InitSchema
+const Schema = `
+    CREATE TABLE IF NOT EXISTS inbox (
+        msg_id UUID PRIMARY KEY,
+        processed_at TIMESTAMP DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_inbox_processed_at ON inbox (processed_at);
+`
+
+// Claim отмечает сообщение обработанным. false — сообщение уже обрабатывалось.
+// Параллельный Claim того же ID ждет завершения первой транзакции.
+func Claim(ctx context.Context, tx *sql.Tx, msgID uuid.UUID) (bool, error) {
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO inbox (msg_id) VALUES ($1) ON CONFLICT (msg_id) DO NOTHING", msgID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+type txKey struct{}
+
+// TxFromContext возвращает транзакцию, открытую Dedup. Обработчик должен писать
+// результат в нее, иначе запись в inbox и бизнес-операция не будут атомарны.
+func TxFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx
+}
+
+// Dedup открывает транзакцию, отмечает сообщение в inbox и передает транзакцию обработчику
+// через контекст. Дубликаты пропускаются, транзакция коммитится после успешной обработки.
+func Dedup(db *sql.DB, key func(kafka.Message) (uuid.UUID, error)) consumer.Middleware {
+	return func(next consumer.Handler) consumer.Handler {
+		return func(ctx context.Context, m kafka.Message) error {
+			msgID, err := key(m)
+			if err != nil {
+				return err
+			}
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			claimed, err := Claim(ctx, tx, msgID)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				log.Printf("Duplicate message ignored: %s", msgID)
+				return nil
+			}
+			if err := next(context.WithValue(ctx, txKey{}, tx), m); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gozon/platform/broker"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/lib/pq"
+)
+
+type CDCConfig struct {
+	// SlotName — постоянный слот логической репликации. Postgres хранит в нем подтвержденный LSN,
+	// поэтому после рестарта чтение продолжается с первой неотправленной транзакции.
+	SlotName    string
+	Publication string
+	// StandbyTimeout — как часто подтверждать LSN серверу
+	StandbyTimeout time.Duration
+	// RetryInterval — пауза перед переподключением после ошибки. next_attempt_at в CDC-режиме
+	// не используется, из Retry берется только MaxAttempts.
+	RetryInterval time.Duration
+	Retry         RetryPolicy
+	// Topics — как в RelayConfig: разрешенные топики, пустой список — любой
+	Topics []string
+}
+
+func DefaultCDCConfig() CDCConfig {
+	return CDCConfig{
+		SlotName:       "gozon_outbox",
+		Publication:    "gozon_outbox",
+		StandbyTimeout: 10 * time.Second,
+		RetryInterval:  5 * time.Second,
+		Retry:          DefaultRetryPolicy(),
+	}
+}
+
+// CDCRelay читает вставки в outbox из логической репликации (pgoutput) и публикует их в Kafka
+// без опроса таблицы. Событие уходит в топик из колонки topic; LSN транзакции подтверждается
+// только после отправки всех ее строк, поэтому при сбое транзакция будет прочитана повторно
+// (at-least-once, как и у Relay). Требует wal_level=logical. Видит только вставки, поэтому
+// рядом нужен страховочный Relay с DefaultCDCFallbackConfig.
+type CDCRelay struct {
+	db       *sql.DB
+	connStr  string
+	producer *broker.Producer
+	cfg      CDCConfig
+}
+
+func NewCDCRelay(db *sql.DB, connStr string, producer *broker.Producer, cfg CDCConfig) *CDCRelay {
+	return &CDCRelay{db: db, connStr: connStr, producer: producer, cfg: cfg}
+}
+
+// Start читает поток изменений до отмены ctx, переподключаясь после ошибок
+func (r *CDCRelay) Start(ctx context.Context) {
+	for {
+		err := r.run(ctx)
+		if ctx.Err() != nil {
+			log.Println("Stopping CDC Relay...")
+			return
+		}
+		log.Printf("CDC relay error, reconnecting in %s: %v", r.cfg.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.cfg.RetryInterval):
+		}
+	}
+}
+
+func (r *CDCRelay) run(ctx context.Context) error {
+	if err := r.setup(ctx); err != nil {
+		return err
+	}
+	conn, err := pgconn.Connect(ctx, replicationDSN(r.connStr))
+	if err != nil {
+		return fmt.Errorf("replication connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	// LSN 0 — продолжить с confirmed_flush_lsn слота
+	err = pglogrepl.StartReplication(ctx, conn, r.cfg.SlotName, 0, pglogrepl.StartReplicationOptions{
+		PluginArgs: []string{"proto_version '1'", fmt.Sprintf("publication_names '%s'", r.cfg.Publication)},
+	})
+	if err != nil {
+		return fmt.Errorf("start replication: %w", err)
+	}
+	log.Printf("CDC relay streaming slot %s", r.cfg.SlotName)
+
+	var (
+		confirmed pglogrepl.LSN
+		inTx      bool
+		pending   []Message
+		relations = map[uint32]*pglogrepl.RelationMessage{}
+		deadline  = time.Now().Add(r.cfg.StandbyTimeout)
+	)
+	for {
+		if time.Now().After(deadline) {
+			err := pglogrepl.SendStandbyStatusUpdate(ctx, conn, pglogrepl.StandbyStatusUpdate{WALWritePosition: confirmed})
+			if err != nil {
+				return fmt.Errorf("standby status update: %w", err)
+			}
+			deadline = time.Now().Add(r.cfg.StandbyTimeout)
+		}
+
+		recvCtx, cancel := context.WithDeadline(ctx, deadline)
+		raw, err := conn.ReceiveMessage(recvCtx)
+		cancel()
+		if err != nil {
+			if pgconn.Timeout(err) && ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+		if errMsg, ok := raw.(*pgproto3.ErrorResponse); ok {
+			return fmt.Errorf("replication error: %s", errMsg.Message)
+		}
+		msg, ok := raw.(*pgproto3.CopyData)
+		if !ok {
+			continue
+		}
+
+		switch msg.Data[0] {
+		case pglogrepl.PrimaryKeepaliveMessageByteID:
+			pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(msg.Data[1:])
+			if err != nil {
+				return err
+			}
+			// Вне транзакции можно подтвердить конец WAL: там только изменения других таблиц,
+			// иначе слот удерживал бы WAL бесконечно
+			if !inTx && pkm.ServerWALEnd > confirmed {
+				confirmed = pkm.ServerWALEnd
+			}
+			if pkm.ReplyRequested {
+				deadline = time.Time{}
+			}
+
+		case pglogrepl.XLogDataByteID:
+			xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
+			if err != nil {
+				return err
+			}
+			logical, err := pglogrepl.Parse(xld.WALData)
+			if err != nil {
+				return fmt.Errorf("parse pgoutput: %w", err)
+			}
+			switch m := logical.(type) {
+			case *pglogrepl.RelationMessage:
+				relations[m.RelationID] = m
+			case *pglogrepl.BeginMessage:
+				inTx = true
+				pending = pending[:0]
+			case *pglogrepl.InsertMessage:
+				rel, ok := relations[m.RelationID]
+				if !ok {
+					return fmt.Errorf("unknown relation %d", m.RelationID)
+				}
+				outboxMsg, err := decodeInsert(rel, m.Tuple)
+				if err != nil {
+					return err
+				}
+				pending = append(pending, outboxMsg)
+			case *pglogrepl.CommitMessage:
+				if err := r.publish(ctx, pending); err != nil {
+					return err
+				}
+				inTx = false
+				confirmed = m.TransactionEndLSN
+			}
+		}
+	}
+}
+
+// setup создает публикацию и слот, если их еще нет
+func (r *CDCRelay) setup(ctx context.Context) error {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", r.cfg.Publication).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err := r.db.ExecContext(ctx, fmt.Sprintf(
+			"CREATE PUBLICATION %s FOR TABLE outbox WITH (publish = 'insert')", pq.QuoteIdentifier(r.cfg.Publication)))
+		if err != nil {
+			return fmt.Errorf("create publication: %w", err)
+		}
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)", r.cfg.SlotName).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err := r.db.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", r.cfg.SlotName)
+		if err != nil {
+			return fmt.Errorf("create replication slot: %w", err)
+		}
+		log.Printf("Created replication slot %s", r.cfg.SlotName)
+	}
+	return nil
+}
+
+// publish отправляет строки транзакции одним WriteMessages и отмечает их обработанными,
+// чтобы при переключении обратно на Relay они не ушли повторно
+func (r *CDCRelay) publish(ctx context.Context, batch []Message) error {
+	group := make([]Message, 0, len(batch))
+	for _, msg := range batch {
+		if !topicAllowed(r.cfg.Topics, msg.Topic) {
+			markDead(ctx, r.db, msg, fmt.Errorf("unknown topic %q", msg.Topic))
+			continue
+		}
+		group = append(group, msg)
+	}
+	if len(group) == 0 {
+		return nil
+	}
+
+	msgs := make([]broker.Message, len(group))
+	for i, msg := range group {
+		msgs[i] = broker.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Payload, Headers: msg.Headers}
+	}
+	errs := r.producer.SendBatch(ctx, msgs)
+	var ids []string
+	var retryErr error
+	for i, msg := range group {
+		if errs != nil && errs[i] != nil {
+			// dead-строку пропускаем, иначе повторяем транзакцию после переподключения
+			// (уже отправленные строки уйдут повторно)
+			if !markFailed(ctx, r.db, r.cfg.Retry, msg, errs[i]) {
+				retryErr = fmt.Errorf("send to Kafka: %w", errs[i])
+			}
+			continue
+		}
+		ids = append(ids, msg.ID.String())
+	}
+	if len(ids) > 0 {
+		_, err := r.db.ExecContext(ctx, "UPDATE outbox SET processed = true WHERE id = ANY($1::uuid[])", pq.Array(ids))
+		if err != nil {
+			log.Printf("Failed to update outbox status: %v", err)
+		}
+		log.Printf("%d messages sent to Kafka", len(ids))
+	}
+	return retryErr
+}
+
+// decodeInsert собирает Message из текстовых значений колонок новой строки outbox
+func decodeInsert(rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData) (Message, error) {
+	var msg Message
+	for i, col := range tuple.Columns {
+		if col.DataType != pglogrepl.TupleDataTypeText {
+			continue
+		}
+		switch rel.Columns[i].Name {
+		case "id":
+			id, err := uuid.ParseBytes(col.Data)
+			if err != nil {
+				return msg, fmt.Errorf("bad outbox id: %w", err)
+			}
+			msg.ID = id
+			if msg.Key == "" {
+				msg.Key = id.String()
+			}
+		case "partition_key":
+			msg.Key = string(col.Data)
+		case "topic":
+			msg.Topic = string(col.Data)
+		case "payload":
+			msg.Payload = col.Data
+		case "payload_bin":
+			// bytea в текстовом формате pgoutput — hex с префиксом \x. NULL (у JSON-строк) отсеян
+			// выше по DataType, а пустое значение не должно затирать уже прочитанный payload.
+			data, err := hex.DecodeString(strings.TrimPrefix(string(col.Data), `\x`))
+			if err != nil {
+				return msg, fmt.Errorf("bad outbox payload_bin: %w", err)
+			}
+			if len(data) > 0 {
+				msg.Payload = data
+			}
+		case "headers":
+			if err := decodeHeaders(col.Data, &msg); err != nil {
+				return msg, err
+			}
+		}
+	}
+	return msg, nil
+}
+
+// replicationDSN добавляет replication=database к строке подключения
+func replicationDSN(connStr string) string {
+	u, err := url.Parse(connStr)
+	if err != nil || u.Scheme == "" {
+		return connStr + " replication=database"
+	}
+	q := u.Query()
+	q.Set("replication", "database")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
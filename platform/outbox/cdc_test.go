@@ -0,0 +1,41 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+)
+
+func TestDecodeInsertPayload(t *testing.T) {
+	rel := &pglogrepl.RelationMessage{Columns: []*pglogrepl.RelationMessageColumn{
+		{Name: "id"}, {Name: "topic"}, {Name: "payload"}, {Name: "payload_bin"},
+	}}
+	text := func(s string) *pglogrepl.TupleDataColumn {
+		return &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Data: []byte(s)}
+	}
+	null := &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	const id = "6f1c1e8e-3f0a-4b8e-9a57-0d5f0b1f8a11"
+
+	tests := []struct {
+		name       string
+		payload    *pglogrepl.TupleDataColumn
+		payloadBin *pglogrepl.TupleDataColumn
+		want       string
+	}{
+		{name: "json with null payload_bin", payload: text(`{"a":1}`), payloadBin: null, want: `{"a":1}`},
+		{name: "json with empty payload_bin", payload: text(`{"a":1}`), payloadBin: text(`\x`), want: `{"a":1}`},
+		{name: "protobuf", payload: null, payloadBin: text(`\x0a0161`), want: "\x0a\x01\x61"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuple := &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{text(id), text("topic"), tt.payload, tt.payloadBin}}
+			msg, err := decodeInsert(rel, tuple)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(msg.Payload) != tt.want {
+				t.Errorf("payload = %q, want %q", msg.Payload, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"gozon/platform/broker"
+)
+
+// StartFromEnv запускает релей outbox для topics в режиме OUTBOX_RELAY_MODE: "poll" (по умолчанию) —
+// опрос таблицы, "cdc" — логическая репликация (нужен wal_level=logical) со страховочным опросом
+// строк, которые не приходят вставкой: requeue из dead и недомеченные processed.
+func StartFromEnv(ctx context.Context, db *sql.DB, connStr string, producer *broker.Producer, topics []string) error {
+	switch mode := os.Getenv("OUTBOX_RELAY_MODE"); mode {
+	case "", "poll":
+		relayCfg := DefaultRelayConfig()
+		relayCfg.Topics = topics
+		go NewRelay(db, connStr, producer, relayCfg).Start(ctx)
+	case "cdc":
+		cdcCfg := DefaultCDCConfig()
+		cdcCfg.Topics = topics
+		go NewCDCRelay(db, connStr, producer, cdcCfg).Start(ctx)
+		fallbackCfg := DefaultCDCFallbackConfig()
+		fallbackCfg.Topics = topics
+		go NewRelay(db, "", producer, fallbackCfg).Start(ctx)
+	default:
+		return fmt.Errorf("bad OUTBOX_RELAY_MODE %q, want poll or cdc", mode)
+	}
+	return nil
+}
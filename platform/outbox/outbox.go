@@ -0,0 +1,99 @@
+// Package outbox реализует transactional outbox: событие пишется в таблицу outbox
+// в транзакции бизнес-операции, а Relay переносит его в Kafka.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"gozon/platform/events"
+)
+
+// NotifyChannel — канал LISTEN/NOTIFY, которым Write будит релеи. Payload — топик события.
+const NotifyChannel = "outbox_events"
+
+// Schema — DDL таблицы outbox, сервисы включают его в свой InitSchema
+const Schema = `
+    CREATE TABLE IF NOT EXISTS outbox (
+        id UUID PRIMARY KEY,
+        topic VARCHAR(100) NOT NULL,
+        payload JSONB NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW(),
+        processed BOOLEAN DEFAULT FALSE
+    );
+
+    -- Аренда строки релеем: пока locked_until не истек, другие инстансы ее не берут
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS locked_by TEXT;
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+    -- Повторы с backoff; dead-строки релей больше не берет, их возвращают через Requeue
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS last_error TEXT;
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW();
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead BOOLEAN NOT NULL DEFAULT FALSE;
+
+    -- Ключ агрегата (заказ, пользователь): ключ сообщения Kafka и единица упорядочивания
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS partition_key TEXT;
+    CREATE INDEX IF NOT EXISTS idx_outbox_pending_key
+        ON outbox (partition_key, created_at) WHERE processed = false;
+
+    -- Атрибуты CloudEvents, релей отправляет их заголовками Kafka
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS headers JSONB;
+
+    -- Данные не в JSON (application/protobuf) хранятся в payload_bin, payload у таких строк NULL
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS payload_bin BYTEA;
+    ALTER TABLE outbox ALTER COLUMN payload DROP NOT NULL;
+
+    -- Частичные индексы: поиск очереди не зависит от объема уже отправленных строк,
+    -- а retention находит старые отправленные строки без полного скана
+    CREATE INDEX IF NOT EXISTS idx_outbox_pending
+        ON outbox (created_at) WHERE processed = false AND dead = false;
+    CREATE INDEX IF NOT EXISTS idx_outbox_processed
+        ON outbox (created_at) WHERE processed = true;
+
+    -- Архив отправленных событий (retention с Archive = true)
+    CREATE TABLE IF NOT EXISTS outbox_archive (
+        id UUID PRIMARY KEY,
+        topic VARCHAR(100) NOT NULL,
+        partition_key TEXT,
+        payload JSONB NOT NULL,
+        created_at TIMESTAMP,
+        archived_at TIMESTAMP DEFAULT NOW()
+    );
+    ALTER TABLE outbox_archive ADD COLUMN IF NOT EXISTS headers JSONB;
+    ALTER TABLE outbox_archive ADD COLUMN IF NOT EXISTS payload_bin BYTEA;
+    ALTER TABLE outbox_archive ALTER COLUMN payload DROP NOT NULL;
+`
+
+// Write сохраняет событие в outbox в рамках транзакции бизнес-операции. key — ID агрегата:
+// события с одним ключом попадают в одну партицию и публикуются в порядке записи.
+// ID строки совпадает с ID события, атрибуты конверта сохраняются в headers. JSON-данные
+// пишутся в payload, остальные форматы — в payload_bin.
+// NOTIFY транзакционный: релеи проснутся только после коммита, а при откате сигнала не будет.
+func Write(ctx context.Context, tx *sql.Tx, topic, key string, event events.Event) error {
+	headers, err := json.Marshal(event.Headers())
+	if err != nil {
+		return err
+	}
+	payload, payloadBin := payloadColumns(event)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox (id, topic, partition_key, payload, payload_bin, headers)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.ID, topic, key, payload, payloadBin, headers,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, topic)
+	return err
+}
+
+// payloadColumns раскладывает данные события по колонкам payload и payload_bin. Неиспользуемая
+// колонка — нетипизированный nil: lib/pq пишет []byte(nil) как пустое значение, а не NULL.
+func payloadColumns(event events.Event) (payload, payloadBin any) {
+	if event.DataContentType == events.ContentTypeJSON {
+		return event.Data, nil
+	}
+	return nil, event.Data
+}
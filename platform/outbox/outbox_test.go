@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"gozon/platform/events"
+)
+
+// recordingDriver запоминает аргументы INSERT INTO outbox в том виде, в каком их получил бы lib/pq
+type recordingDriver struct {
+	mu      sync.Mutex
+	inserts [][]driver.NamedValue
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d: d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.Contains(query, "INSERT INTO outbox") {
+		c.d.mu.Lock()
+		c.d.inserts = append(c.d.inserts, args)
+		c.d.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+var testDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("outbox-recording", testDriver)
+}
+
+func TestWriteLeavesUnusedPayloadColumnNull(t *testing.T) {
+	db, err := sql.Open("outbox-recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+		// wantPayload / wantBin — в какую колонку попадают данные; другая должна быть NULL
+		wantPayload bool
+		wantBin     bool
+	}{
+		{name: "json", contentType: events.ContentTypeJSON, data: []byte(`{"a":1}`), wantPayload: true},
+		{name: "protobuf", contentType: events.ContentTypeProtobuf, data: []byte{0x0a, 0x01, 0x61}, wantBin: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDriver.mu.Lock()
+			testDriver.inserts = nil
+			testDriver.mu.Unlock()
+
+			tx, err := db.BeginTx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := events.Event{ID: "id-" + tt.name, Type: "test", DataContentType: tt.contentType, Data: tt.data}
+			if err := Write(context.Background(), tx, "topic", "key", event); err != nil {
+				t.Fatal(err)
+			}
+			tx.Commit()
+
+			testDriver.mu.Lock()
+			defer testDriver.mu.Unlock()
+			if len(testDriver.inserts) != 1 {
+				t.Fatalf("got %d inserts, want 1", len(testDriver.inserts))
+			}
+			// Аргументы: id, topic, partition_key, payload, payload_bin, headers
+			args := testDriver.inserts[0]
+			checkColumn(t, "payload", args[3].Value, tt.wantPayload, tt.data)
+			checkColumn(t, "payload_bin", args[4].Value, tt.wantBin, tt.data)
+		})
+	}
+}
+
+func checkColumn(t *testing.T, name string, value driver.Value, wantData bool, data []byte) {
+	t.Helper()
+	if !wantData {
+		if value != nil {
+			t.Errorf("%s = %#v, want NULL", name, value)
+		}
+		return
+	}
+	got, ok := value.([]byte)
+	if !ok || string(got) != string(data) {
+		t.Errorf("%s = %#v, want %q", name, value, data)
+	}
+}
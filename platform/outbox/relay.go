@@ -0,0 +1,323 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gozon/platform/broker"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type Message struct {
+	ID uuid.UUID
+	// Key — ключ упорядочивания (partition_key, для старых строк — ID): сообщения с одним ключом
+	// отправляются одним воркером по порядку и попадают в одну партицию Kafka.
+	Key     string
+	Topic   string
+	Payload []byte
+	// Headers — атрибуты CloudEvents (пусто у строк, записанных до конверта)
+	Headers   map[string]string
+	CreatedAt time.Time
+}
+
+type RelayConfig struct {
+	// PollInterval — страховочный опрос на случай пропущенного NOTIFY (разрыв LISTEN-соединения)
+	PollInterval time.Duration
+	BatchSize    int
+	// Parallelism — число воркеров, между которыми пачка делится по ключу
+	Parallelism int
+	// LeaseDuration — на сколько строки закрепляются за инстансом. Должно с запасом
+	// превышать время отправки пачки, иначе после истечения аренды строку возьмет другой релей.
+	LeaseDuration time.Duration
+	// MinAge — строки моложе этого возраста не захватываются. Нужно страховочному релею рядом с
+	// CDCRelay: свежие вставки публикует CDC, а релей подбирает только то, что CDC не увидит.
+	MinAge time.Duration
+	Retry  RetryPolicy
+	// Topics — топики, в которые сервис пишет через outbox. Релей создает их при старте,
+	// а строки с другим топиком сразу уходят в dead. Пустой список — любой топик.
+	Topics                 []string
+	TopicPartitions        int
+	TopicReplicationFactor int
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		PollInterval:  5 * time.Second,
+		BatchSize:     100,
+		Parallelism:   4,
+		LeaseDuration: 30 * time.Second,
+		Retry:         DefaultRetryPolicy(),
+
+		TopicPartitions:        3,
+		TopicReplicationFactor: 1,
+	}
+}
+
+// DefaultCDCFallbackConfig — страховочный релей для режима CDC: редкий опрос строк старше минуты.
+// Логическая репликация видит только INSERT, поэтому без него остаются висеть строки, возвращенные
+// из dead через RequeueDead (UPDATE), и строки, у которых после отправки не удалось проставить processed.
+// Строку, которую CDC публикует дольше MinAge, релей может отправить повторно (at-least-once).
+func DefaultCDCFallbackConfig() RelayConfig {
+	cfg := DefaultRelayConfig()
+	cfg.PollInterval = time.Minute
+	cfg.MinAge = time.Minute
+	return cfg
+}
+
+// Relay переносит события из outbox в Kafka, отправляя каждую строку в топик из колонки topic.
+// Несколько реплик безопасны: строки арендуются инстансом и не публикуются другими, пока аренда действует.
+// Релей спит до NOTIFY из Write; если connStr пустой, работает только опросом.
+type Relay struct {
+	db         *sql.DB
+	connStr    string
+	producer   *broker.Producer
+	cfg        RelayConfig
+	instanceID string
+}
+
+func NewRelay(db *sql.DB, connStr string, producer *broker.Producer, cfg RelayConfig) *Relay {
+	return &Relay{db: db, connStr: connStr, producer: producer, cfg: cfg, instanceID: uuid.NewString()}
+}
+
+// Start обрабатывает outbox до отмены ctx: при старте, по NOTIFY и раз в PollInterval
+func (r *Relay) Start(ctx context.Context) {
+	if len(r.cfg.Topics) > 0 {
+		if err := r.producer.EnsureTopics(r.cfg.TopicPartitions, r.cfg.TopicReplicationFactor, r.cfg.Topics...); err != nil {
+			// Не фатально: writer создаст топики сам (AllowAutoTopicCreation) с настройками брокера
+			log.Printf("Failed to create outbox topics %v: %v", r.cfg.Topics, err)
+		}
+	}
+	var wake <-chan *pq.Notification
+	if r.connStr != "" {
+		listener := pq.NewListener(r.connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Outbox listener error: %v", err)
+			}
+		})
+		defer listener.Close()
+		if err := listener.Listen(NotifyChannel); err != nil {
+			log.Printf("Outbox LISTEN failed, falling back to polling: %v", err)
+		} else {
+			wake = listener.Notify
+		}
+	}
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		r.drain(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping Message Relay...")
+			return
+		case <-ticker.C:
+		// nil приходит после переподключения LISTEN: сигналы могли потеряться, поэтому тоже проверяем outbox
+		case <-wake:
+		}
+	}
+}
+
+// drain отправляет пачки, пока outbox не опустеет: один NOTIFY может означать много строк
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil && r.processBatch(ctx) == r.cfg.BatchSize {
+	}
+}
+
+// processBatch отправляет одну пачку и возвращает число захваченных сообщений.
+// Пачка делится на Parallelism групп по хешу ключа: группы уходят в Kafka параллельно,
+// внутри группы сообщения идут одним WriteMessages в порядке created_at.
+func (r *Relay) processBatch(ctx context.Context) int {
+	batch, err := r.claim(ctx)
+	if err != nil {
+		log.Printf("Error claiming outbox: %v", err)
+		return 0
+	}
+	if len(batch) == 0 {
+		return 0
+	}
+
+	groups := make([][]Message, max(r.cfg.Parallelism, 1))
+	for _, msg := range batch {
+		if !topicAllowed(r.cfg.Topics, msg.Topic) {
+			markDead(ctx, r.db, msg, fmt.Errorf("unknown topic %q", msg.Topic))
+			continue
+		}
+		g := keyHash(msg.Key) % uint32(len(groups))
+		groups[g] = append(groups[g], msg)
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		sent []string
+	)
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(group []Message) {
+			defer wg.Done()
+			ok := r.send(ctx, group)
+			mu.Lock()
+			sent = append(sent, ok...)
+			mu.Unlock()
+		}(group)
+	}
+	wg.Wait()
+
+	if len(sent) > 0 {
+		// Помечаем отправленные одним запросом, только если аренда все еще наша
+		res, err := r.db.ExecContext(ctx, `
+			UPDATE outbox SET processed = true, locked_by = NULL, locked_until = NULL
+			WHERE id = ANY($1::uuid[]) AND locked_by = $2`, pq.Array(sent), r.instanceID)
+		if err != nil {
+			log.Printf("Failed to update outbox status: %v", err)
+		} else if n, _ := res.RowsAffected(); n < int64(len(sent)) {
+			log.Printf("Outbox lease expired for %d messages before publish finished, they may be sent twice", int64(len(sent))-n)
+		}
+		log.Printf("%d messages sent to Kafka", len(sent))
+	}
+	return len(batch)
+}
+
+// send отправляет группу и возвращает ID записанных сообщений. Неудачные строки
+// откладываются с backoff и не блокируют другие ключи. Более поздние сообщения ключа, у которого
+// отправка не удалась, не считаются отправленными: аренда с них снимается, и claim не возьмет
+// их раньше отложенной строки, чтобы порядок внутри ключа сохранился.
+func (r *Relay) send(ctx context.Context, group []Message) []string {
+	msgs := make([]broker.Message, len(group))
+	for i, msg := range group {
+		msgs[i] = broker.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Payload, Headers: msg.Headers}
+	}
+	errs := r.producer.SendBatch(ctx, msgs)
+	sent := make([]string, 0, len(group))
+	var deferred []string
+	failedKeys := make(map[string]bool)
+	for i, msg := range group {
+		if errs != nil && errs[i] != nil {
+			markFailed(ctx, r.db, r.cfg.Retry, msg, errs[i])
+			failedKeys[msg.Key] = true
+			continue
+		}
+		if failedKeys[msg.Key] {
+			deferred = append(deferred, msg.ID.String())
+			continue
+		}
+		sent = append(sent, msg.ID.String())
+	}
+	if len(deferred) > 0 {
+		r.release(ctx, deferred)
+	}
+	return sent
+}
+
+// release снимает аренду со строк, чтобы их отправили заново вслед за отложенной строкой того же ключа
+func (r *Relay) release(ctx context.Context, ids []string) {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox SET locked_by = NULL, locked_until = NULL
+		WHERE id = ANY($1::uuid[]) AND locked_by = $2`, pq.Array(ids), r.instanceID)
+	if err != nil {
+		log.Printf("Failed to release outbox messages: %v", err)
+		return
+	}
+	log.Printf("%d outbox messages deferred behind a failed message with the same key", len(ids))
+}
+
+func topicAllowed(topics []string, topic string) bool {
+	return len(topics) == 0 || slices.Contains(topics, topic)
+}
+
+// decodeHeaders разбирает колонку headers; NULL у старых строк оставляет Headers пустым
+func decodeHeaders(raw []byte, msg *Message) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, &msg.Headers); err != nil {
+		return fmt.Errorf("bad headers of outbox message %s: %w", msg.ID, err)
+	}
+	return nil
+}
+
+func keyHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// claim арендует пачку строк одной транзакцией, locked_until закрепляет их за релеем на время
+// отправки. Строки с истекшей арендой (релей упал посреди пачки) забираются заново.
+// Захваты разных релеев идут по очереди под advisory-локом: иначе второй релей не видит еще не
+// закоммиченную аренду первого, пропускает его строку по SKIP LOCKED и забирает следующее
+// событие того же ключа, обгоняя его.
+func (r *Relay) claim(ctx context.Context) ([]Message, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	// Лок берется отдельным запросом: снимок UPDATE ниже уже видит аренды предыдущего захвата
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('outbox_claim'))"); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE outbox
+		SET locked_by = $1, locked_until = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE processed = false AND dead = false
+			  AND next_attempt_at <= NOW()
+			  AND created_at <= NOW() - make_interval(secs => $4)
+			  AND (locked_until IS NULL OR locked_until < NOW())
+			  -- Не обгоняем более раннее событие того же ключа, отложенное backoff'ом или взятое другим релеем
+			  AND NOT EXISTS (
+				SELECT 1 FROM outbox prev
+				WHERE prev.partition_key = outbox.partition_key
+				  AND prev.processed = false AND prev.dead = false
+				  AND prev.created_at < outbox.created_at
+				  AND (prev.next_attempt_at > NOW() OR prev.locked_until >= NOW())
+			  )
+			ORDER BY created_at ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(partition_key, id::text), topic,
+			COALESCE(payload_bin, convert_to(payload::text, 'UTF8')), headers, created_at
+	`, r.instanceID, r.cfg.LeaseDuration.Seconds(), r.cfg.BatchSize, r.cfg.MinAge.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var batch []Message
+	for rows.Next() {
+		var (
+			msg     Message
+			headers []byte
+		)
+		if err := rows.Scan(&msg.ID, &msg.Key, &msg.Topic, &msg.Payload, &headers, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := decodeHeaders(headers, &msg); err != nil {
+			return nil, err
+		}
+		batch = append(batch, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(batch, func(i, j int) bool { return batch[i].CreatedAt.Before(batch[j].CreatedAt) })
+	return batch, nil
+}
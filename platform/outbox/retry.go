@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration // задержка после первой неудачи, дальше удваивается
+	MaxBackoff  time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 10,
+		BaseBackoff: time.Second,
+		MaxBackoff:  5 * time.Minute,
+	}
+}
+
+// markFailed записывает неудачную попытку, снимает аренду и откладывает строку
+// на BaseBackoff * 2^(attempts-1), но не больше MaxBackoff. Счетчик берется из БД, а не из msg:
+// CDC-релей видит строку такой, какой она была вставлена. Возвращает true, если строка ушла в dead.
+func markFailed(ctx context.Context, db *sql.DB, policy RetryPolicy, msg Message, cause error) bool {
+	var attempts int
+	var dead bool
+	err := db.QueryRowContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, dead = attempts + 1 >= $3,
+		    next_attempt_at = NOW() + make_interval(secs => LEAST($4 * power(2, attempts), $5)),
+		    locked_by = NULL, locked_until = NULL
+		WHERE id = $1
+		RETURNING attempts, dead`,
+		msg.ID, cause.Error(), policy.MaxAttempts, policy.BaseBackoff.Seconds(), policy.MaxBackoff.Seconds(),
+	).Scan(&attempts, &dead)
+	if err != nil {
+		log.Printf("Failed to update outbox message %s: %v", msg.ID, err)
+		return false
+	}
+	if dead {
+		log.Printf("Outbox message %s moved to dead-letter after %d attempts: %v", msg.ID, attempts, cause)
+	} else {
+		log.Printf("Failed to send outbox message %s to Kafka (attempt %d): %v", msg.ID, attempts, cause)
+	}
+	return dead
+}
+
+// markDead сразу переводит строку в dead: повтор не поможет (например, топик не разрешен)
+func markDead(ctx context.Context, db *sql.DB, msg Message, cause error) {
+	_, err := db.ExecContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, dead = true, locked_by = NULL, locked_until = NULL
+		WHERE id = $1`, msg.ID, cause.Error())
+	if err != nil {
+		log.Printf("Failed to update outbox message %s: %v", msg.ID, err)
+		return
+	}
+	log.Printf("Outbox message %s moved to dead-letter: %v", msg.ID, cause)
+}
+
+// DeadMessage — строка outbox, исчерпавшая все попытки отправки
+type DeadMessage struct {
+	ID    uuid.UUID `json:"id"`
+	Topic string    `json:"topic"`
+	// Payload — JSON-данные или base64-строка для бинарных форматов
+	Payload     json.RawMessage `json:"payload" swaggertype:"object"`
+	ContentType string          `json:"content_type"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ListDead возвращает dead-строки outbox, новые первыми
+func ListDead(ctx context.Context, db *sql.DB, limit int) ([]*DeadMessage, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, topic, COALESCE(payload, to_jsonb(encode(payload_bin, 'base64'))),
+			COALESCE(headers->>'content-type', 'application/json'), attempts, COALESCE(last_error, ''), created_at
+		FROM outbox
+		WHERE dead = true
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*DeadMessage
+	for rows.Next() {
+		var m DeadMessage
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Payload, &m.ContentType, &m.Attempts, &m.LastError, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &m)
+	}
+	return messages, rows.Err()
+}
+
+// RequeueDead возвращает dead-строки в очередь со сброшенным счетчиком попыток.
+// Пустой ids означает "все dead-строки".
+func RequeueDead(ctx context.Context, db *sql.DB, ids []uuid.UUID) (int64, error) {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE outbox
+		SET dead = false, attempts = 0, next_attempt_at = NOW()
+		WHERE dead = true AND (cardinality($1::uuid[]) = 0 OR id = ANY($1::uuid[]))`,
+		pq.Array(strs),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if n > 0 {
+		// Будим релеи, иначе строки уйдут только на страховочном опросе
+		db.ExecContext(ctx, "SELECT pg_notify($1, '')", NotifyChannel)
+	}
+	return n, err
+}
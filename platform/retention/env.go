@@ -0,0 +1,40 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ConfigFromEnv — DefaultConfig, переопределенный переменными окружения: OUTBOX_RETENTION,
+// INBOX_RETENTION (только при inbox; без inbox записи inbox не чистятся) и OUTBOX_ARCHIVE=true.
+// Результат проверяется Validate.
+func ConfigFromEnv(inbox bool) (Config, error) {
+	cfg := DefaultConfig()
+	if err := durationFromEnv("OUTBOX_RETENTION", &cfg.OutboxRetention); err != nil {
+		return Config{}, err
+	}
+	if !inbox {
+		cfg.InboxRetention = 0
+	} else if err := durationFromEnv("INBOX_RETENTION", &cfg.InboxRetention); err != nil {
+		return Config{}, err
+	}
+	cfg.Archive = os.Getenv("OUTBOX_ARCHIVE") == "true"
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func durationFromEnv(name string, dst *time.Duration) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("bad %s %q", name, v)
+	}
+	*dst = d
+	return nil
+}
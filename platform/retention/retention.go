@@ -0,0 +1,149 @@
+// Package retention периодически удаляет (или архивирует) отправленные строки outbox
+// и старые записи inbox небольшими пачками, чтобы не держать долгие блокировки.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+type Config struct {
+	Interval time.Duration
+	// BatchSize — сколько строк удаляется одним запросом
+	BatchSize int
+	// OutboxRetention — сколько хранить отправленные строки outbox. Dead и неотправленные не трогаются.
+	OutboxRetention time.Duration
+	// Archive переносит строки outbox в outbox_archive вместо удаления
+	Archive bool
+	// InboxRetention должно превышать окно, в котором возможен повтор сообщения из Kafka,
+	// иначе старый дубликат будет обработан повторно. 0 — inbox не чистится (у сервиса его нет).
+	InboxRetention time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:        time.Hour,
+		BatchSize:       1000,
+		OutboxRetention: 7 * 24 * time.Hour,
+		InboxRetention:  30 * 24 * time.Hour,
+	}
+}
+
+// Validate проверяет настройки: Interval и BatchSize положительные (иначе тикер паникует,
+// а цикл purge никогда не закончится), OutboxRetention положительный (иначе удаляются только что
+// отправленные строки), InboxRetention не отрицательный (0 — inbox не чистится)
+func (c Config) Validate() error {
+	if c.Interval <= 0 {
+		return errors.New("retention Interval must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return errors.New("retention BatchSize must be positive")
+	}
+	if c.OutboxRetention <= 0 {
+		return errors.New("retention OutboxRetention must be positive")
+	}
+	if c.InboxRetention < 0 {
+		return errors.New("retention InboxRetention must not be negative")
+	}
+	return nil
+}
+
+type Cleaner struct {
+	db  *sql.DB
+	cfg Config
+}
+
+func NewCleaner(db *sql.DB, cfg Config) *Cleaner {
+	return &Cleaner{db: db, cfg: cfg}
+}
+
+// Start чистит таблицы при старте и затем раз в Interval до отмены ctx
+func (c *Cleaner) Start(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		c.run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cleaner) run(ctx context.Context) {
+	outboxQuery := `
+		WITH deleted AS (
+			DELETE FROM outbox
+			WHERE id IN (
+				SELECT id FROM outbox
+				WHERE processed = true AND created_at < NOW() - make_interval(secs => $1)
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id
+		)
+		SELECT count(*) FROM deleted`
+	if c.cfg.Archive {
+		// Считаем удаленные строки, а не вставленные: при ON CONFLICT их меньше,
+		// и purge остановился бы раньше, чем outbox опустеет
+		outboxQuery = `
+		WITH moved AS (
+			DELETE FROM outbox
+			WHERE id IN (
+				SELECT id FROM outbox
+				WHERE processed = true AND created_at < NOW() - make_interval(secs => $1)
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, topic, partition_key, payload, payload_bin, headers, created_at
+		), archived AS (
+			INSERT INTO outbox_archive (id, topic, partition_key, payload, payload_bin, headers, created_at)
+			SELECT id, topic, partition_key, payload, payload_bin, headers, created_at FROM moved
+			ON CONFLICT (id) DO NOTHING
+		)
+		SELECT count(*) FROM moved`
+	}
+	if n := c.purge(ctx, outboxQuery, c.cfg.OutboxRetention); n > 0 {
+		log.Printf("Retention: removed %d processed outbox rows", n)
+	}
+
+	if c.cfg.InboxRetention > 0 {
+		inboxQuery := `
+		WITH deleted AS (
+			DELETE FROM inbox
+			WHERE msg_id IN (
+				SELECT msg_id FROM inbox
+				WHERE processed_at < NOW() - make_interval(secs => $1)
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING msg_id
+		)
+		SELECT count(*) FROM deleted`
+		if n := c.purge(ctx, inboxQuery, c.cfg.InboxRetention); n > 0 {
+			log.Printf("Retention: removed %d inbox rows", n)
+		}
+	}
+}
+
+// purge повторяет query пачками, пока есть что удалять. query возвращает число удаленных строк.
+// Возвращает общее число строк.
+func (c *Cleaner) purge(ctx context.Context, query string, retention time.Duration) int64 {
+	var total int64
+	for ctx.Err() == nil {
+		var n int64
+		if err := c.db.QueryRowContext(ctx, query, retention.Seconds(), c.cfg.BatchSize).Scan(&n); err != nil {
+			log.Printf("Retention query failed: %v", err)
+			return total
+		}
+		total += n
+		if n < int64(c.cfg.BatchSize) {
+			return total
+		}
+	}
+	return total
+}